@@ -66,6 +66,11 @@ func main() {
 		"authorName":   "System",
 		"authorUserId": u1.UserId,
 		"tags":         []string{"恋爱", "校园"},
+		"status":       "approved",
+		"characters": []model.BackstoryCharacter{
+			{CharacterId: "A", Name: "角色A"},
+			{CharacterId: "B", Name: "角色B"},
+		},
 		"createdAt":    now,
 		"updatedAt":    now,
 	}}, upsert)
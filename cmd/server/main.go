@@ -15,6 +15,7 @@ import (
 	"go.uber.org/zap"
 
 	"actiondelta/internal/config"
+	"actiondelta/internal/controller"
 	"actiondelta/internal/indexer"
 	"actiondelta/internal/repository"
 	"actiondelta/internal/router"
@@ -55,6 +56,29 @@ func main() {
     }
     printSuccess("Database indexes ensured")
 
+    // 在线状态仅由本进程的实时连接维护，启动时清除遗留标记
+    if err := controller.ResetPresence(context.Background()); err != nil {
+        zap.L().Warn("failed to reset presence", zap.Error(err))
+    }
+    if err := controller.BackfillBackstoryStatus(context.Background()); err != nil {
+        zap.L().Warn("failed to backfill backstory status", zap.Error(err))
+    }
+    if err := controller.BackfillDMConversations(context.Background()); err != nil {
+        zap.L().Warn("failed to backfill dm conversations", zap.Error(err))
+    }
+
+    // 后台任务（退出时取消）：归档长时间无新消息的房间
+    bgCtx, stopBackground := context.WithCancel(context.Background())
+    defer stopBackground()
+    controller.StartRoomArchiver(bgCtx)
+
+    // 为早期消息补齐检索词需扫描整个消息集合，在后台执行，不阻塞启动
+    go func() {
+        if err := controller.BackfillSearchTokens(bgCtx); err != nil && bgCtx.Err() == nil {
+            zap.L().Warn("failed to backfill search tokens", zap.Error(err))
+        }
+    }()
+
     // 创建路由
     printStep("🛣️  Setting up routes...")
     r := router.New()
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"actiondelta/internal/config"
+)
+
+// fileAudience 文件访问令牌的 aud，与登录令牌区分
+const fileAudience = "file_access"
+
+// FileClaims 文件访问令牌负载：ID（jti）为文件 ID，Subject 为签发时的用户 ID。
+type FileClaims struct {
+	jwt.RegisteredClaims
+}
+
+// fileKey 文件访问令牌使用由 JWT 密钥派生的独立签名密钥，泄露后无法当作登录令牌使用。
+func fileKey() []byte { return []byte(config.C.JWT.Secret + ":" + fileAudience) }
+
+// GenerateFileToken 为用户签发仅对单个文件有效的短期令牌，用于 <img>/<audio> 等无法携带请求头的加载方式。
+func GenerateFileToken(fileId, userId string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, FileClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        fileId,
+			Subject:   userId,
+			Audience:  jwt.ClaimStrings{fileAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
+	return t.SignedString(fileKey())
+}
+
+// ParseFileToken 校验文件访问令牌的签名、受众与有效期，并要求令牌签发给 fileId。
+func ParseFileToken(token, fileId string) (*FileClaims, error) {
+	t, err := jwt.ParseWithClaims(token, &FileClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return fileKey(), nil
+	}, jwt.WithAudience(fileAudience), jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	if claims, ok := t.Claims.(*FileClaims); ok && t.Valid && claims.ID == fileId && claims.Subject != "" {
+		return claims, nil
+	}
+	return nil, jwt.ErrTokenInvalidClaims
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"actiondelta/internal/config"
+)
+
+// inviteAudience 邀请令牌的 aud，与登录令牌区分
+const inviteAudience = "room_invite"
+
+// InviteClaims 房间邀请令牌负载，ID（jti）为邀请记录 ID。
+type InviteClaims struct {
+	RoomId string `json:"room_id"`
+	jwt.RegisteredClaims
+}
+
+// inviteKey 邀请令牌使用由 JWT 密钥派生的独立签名密钥，避免被当作登录令牌使用。
+func inviteKey() []byte { return []byte(config.C.JWT.Secret + ":" + inviteAudience) }
+
+// GenerateInviteToken 为邀请记录签发带过期时间的令牌。
+func GenerateInviteToken(inviteId, roomId string, expiresAt time.Time) (string, error) {
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, InviteClaims{
+		RoomId: roomId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        inviteId,
+			Audience:  jwt.ClaimStrings{inviteAudience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
+	return t.SignedString(inviteKey())
+}
+
+// ParseInviteToken 校验邀请令牌的签名、受众与有效期。
+func ParseInviteToken(token string) (*InviteClaims, error) {
+	t, err := jwt.ParseWithClaims(token, &InviteClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return inviteKey(), nil
+	}, jwt.WithAudience(inviteAudience), jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	if claims, ok := t.Claims.(*InviteClaims); ok && t.Valid {
+		return claims, nil
+	}
+	return nil, jwt.ErrTokenInvalidClaims
+}
@@ -2,6 +2,7 @@ package config
 
 import (
     "fmt"
+    "os"
     "time"
 
     "github.com/spf13/viper"
@@ -11,7 +12,8 @@ var C Config
 
 type Config struct {
     Server struct {
-        Port int `mapstructure:"port"`
+        Port       int    `mapstructure:"port"`
+        InstanceId string `mapstructure:"instance_id"` // 多实例部署时区分各实例的在线连接，缺省为主机名
     } `mapstructure:"server"`
     JWT struct {
         Secret         string `mapstructure:"secret"`
@@ -26,6 +28,15 @@ type Config struct {
         Enabled  bool   `mapstructure:"enabled"`
         MockCode string `mapstructure:"mock_code"`
     } `mapstructure:"sms"`
+    Admin struct {
+        UserIds []string `mapstructure:"user_ids"`
+    } `mapstructure:"admin"`
+    Message struct {
+        RecallWindowSec int `mapstructure:"recall_window_seconds"`
+    } `mapstructure:"message"`
+    Room struct {
+        ArchiveAfterHours int `mapstructure:"archive_after_hours"`
+    } `mapstructure:"room"`
 }
 
 func Load() error {
@@ -39,6 +50,8 @@ func Load() error {
     v.SetDefault("server.port", 8080)
     v.SetDefault("jwt.access_ttl_minutes", 30)
     v.SetDefault("jwt.refresh_ttl_days", 14)
+    v.SetDefault("message.recall_window_seconds", 120)
+    v.SetDefault("room.archive_after_hours", 72)
 
     if err := v.ReadInConfig(); err != nil {
         fmt.Printf("warning: using defaults/env, failed to read config: %v\n", err)
@@ -51,4 +64,30 @@ func Load() error {
 
 func AccessTTL() time.Duration { return time.Duration(C.JWT.AccessTTLMin) * time.Minute }
 func RefreshTTL() time.Duration { return time.Duration(C.JWT.RefreshTTLDays) * 24 * time.Hour }
+func RecallWindow() time.Duration { return time.Duration(C.Message.RecallWindowSec) * time.Second }
+func RoomArchiveAfter() time.Duration { return time.Duration(C.Room.ArchiveAfterHours) * time.Hour }
 
+// InstanceID 当前实例标识：优先取配置，否则为主机名（重启后不变，便于清理本实例遗留的在线标记）。
+func InstanceID() string {
+    if C.Server.InstanceId != "" {
+        return C.Server.InstanceId
+    }
+    if host, err := os.Hostname(); err == nil && host != "" {
+        return host
+    }
+    return "default"
+}
+
+
+// IsAdmin 判断用户是否在管理员名单中。
+func IsAdmin(userId string) bool {
+    if userId == "" {
+        return false
+    }
+    for _, id := range C.Admin.UserIds {
+        if id == userId {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,351 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"actiondelta/internal/model"
+	"actiondelta/internal/repository"
+)
+
+// 剧本审核状态
+const (
+	backstoryDraft     = "draft"
+	backstorySubmitted = "submitted"
+	backstoryApproved  = "approved"
+	backstoryRejected  = "rejected"
+)
+
+type backstoryReq struct {
+	Title      *string                    `json:"title"`
+	Subtitle   *string                    `json:"subtitle"`
+	Cover      []model.BackstoryCover     `json:"cover"`
+	Content    *string                    `json:"content"`
+	AuthorName *string                    `json:"author_name"`
+	Tags       []string                   `json:"tags"`
+	Characters []model.BackstoryCharacter `json:"characters"`
+}
+
+// ListBackstories 剧本列表（分页，支持标签与关键词筛选，仅展示审核通过的剧本）
+func ListBackstories(c *gin.Context) {
+	page := parseIntDefault(c.DefaultQuery("page", "1"), 1)
+	size := parseIntDefault(c.DefaultQuery("size", "20"), 20)
+	keyword := c.Query("keyword")
+
+	filter := bson.M{"deletedAt": nil, "status": backstoryApproved}
+	if tags := queryTags(c); len(tags) > 0 {
+		filter["tags"] = bson.M{"$all": tags}
+	}
+	if keyword != "" {
+		re := bson.M{"$regex": regexp.QuoteMeta(keyword), "$options": "i"}
+		filter["$or"] = []bson.M{{"title": re}, {"subtitle": re}, {"tags": re}}
+	}
+
+	col := repository.DB().Collection("backstories")
+	total, _ := col.CountDocuments(c, filter)
+	opts := options.Find().
+		SetSort(bson.M{"createdAt": -1}).
+		SetSkip(int64((page - 1) * size)).
+		SetLimit(int64(size)).
+		SetProjection(bson.M{"content": 0, "characters": 0, "revision": 0})
+	cur, err := col.Find(c, filter, opts)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "查询失败", nil)
+		return
+	}
+	var list []model.Backstory
+	_ = cur.All(c, &list)
+	respond(c, http.StatusOK, "success", gin.H{"total": total, "list": list})
+}
+
+// GetBackstory 剧本详情（审核通过的剧本任何人可见且点击量 +1；未通过的及修订稿仅作者可见）
+func GetBackstory(c *gin.Context) {
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	col := repository.DB().Collection("backstories")
+	var b model.Backstory
+	if err := col.FindOne(c, bson.M{"_id": oid, "deletedAt": nil}).Decode(&b); err != nil {
+		respond(c, http.StatusNotFound, "not found", nil)
+		return
+	}
+	if b.Status != backstoryApproved {
+		if viewer := c.GetString("userId"); viewer == "" || viewer != b.AuthorUserId {
+			respond(c, http.StatusNotFound, "not found", nil)
+			return
+		}
+		respond(c, http.StatusOK, "success", b)
+		return
+	}
+	if viewer := c.GetString("userId"); viewer == "" || viewer != b.AuthorUserId {
+		b.Revision = nil
+	}
+	_, _ = col.UpdateByID(c, oid, bson.M{"$inc": bson.M{"viewCount": 1}})
+	b.ViewCount++
+	respond(c, http.StatusOK, "success", b)
+}
+
+// ListMyBackstories 我创建的剧本（含各审核状态）
+func ListMyBackstories(c *gin.Context) {
+	userId := c.GetString("userId")
+	cur, err := repository.DB().Collection("backstories").Find(c,
+		bson.M{"authorUserId": userId, "deletedAt": nil},
+		options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	var list []model.Backstory
+	_ = cur.All(c, &list)
+	respond(c, http.StatusOK, "success", gin.H{"list": list})
+}
+
+// CreateBackstory 创建剧本（当前用户为作者）
+func CreateBackstory(c *gin.Context) {
+	userId := c.GetString("userId")
+	var req backstoryReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.Title == nil || strings.TrimSpace(*req.Title) == "" {
+		respond(c, http.StatusBadRequest, "invalid request", nil)
+		return
+	}
+	chars, err := normalizeCharacters(req.Characters)
+	if err != nil {
+		respond(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	authorName := ""
+	if req.AuthorName != nil {
+		authorName = *req.AuthorName
+	}
+	if authorName == "" {
+		var u model.User
+		if err := repository.DB().Collection("users").FindOne(c, bson.M{"userId": userId}).Decode(&u); err == nil {
+			authorName = u.Nickname
+		}
+	}
+	now := time.Now()
+	b := model.Backstory{
+		Title:        strings.TrimSpace(*req.Title),
+		Cover:        req.Cover,
+		AuthorName:   authorName,
+		AuthorUserId: userId,
+		Tags:         normalizeTags(req.Tags),
+		Characters:   chars,
+		Status:       backstoryDraft,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if req.Subtitle != nil {
+		b.Subtitle = *req.Subtitle
+	}
+	if req.Content != nil {
+		b.Content = *req.Content
+	}
+	res, err := repository.DB().Collection("backstories").InsertOne(c, b)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	id := res.InsertedID.(primitive.ObjectID)
+	respond(c, http.StatusOK, "success", gin.H{"id": id.Hex()})
+}
+
+// UpdateBackstory 修改剧本（仅作者，未传字段保持不变）。
+// 审核中的剧本不可修改；草稿或已驳回的剧本修改后回到草稿，需重新投送审核；
+// 已通过的剧本修改写入修订稿（revision），重新审核通过前公开展示的仍是原内容。
+func UpdateBackstory(c *gin.Context) {
+	userId := c.GetString("userId")
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	var req backstoryReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond(c, http.StatusBadRequest, "invalid request", nil)
+		return
+	}
+	var b model.Backstory
+	if err := repository.DB().Collection("backstories").FindOne(c, bson.M{"_id": oid, "authorUserId": userId, "deletedAt": nil}).Decode(&b); err != nil {
+		respond(c, http.StatusForbidden, "forbidden or not found", nil)
+		return
+	}
+	if b.Status == backstorySubmitted || (b.Revision != nil && b.Revision.Status == backstorySubmitted) {
+		respond(c, http.StatusConflict, "under review", nil)
+		return
+	}
+	rev := backstoryRevisionOf(b)
+	if b.Revision != nil {
+		rev = *b.Revision
+	}
+	if err := req.apply(&rev); err != nil {
+		respond(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	now := time.Now()
+	filter := bson.M{"_id": oid, "authorUserId": userId, "status": b.Status, "deletedAt": nil}
+	var set bson.M
+	if b.Status == backstoryApproved {
+		rev.Status = backstoryDraft
+		rev.UpdatedAt = now
+		filter["revision.status"] = bson.M{"$ne": backstorySubmitted}
+		set = bson.M{"revision": rev}
+	} else {
+		set = bson.M{
+			"title":      rev.Title,
+			"subtitle":   rev.Subtitle,
+			"cover":      rev.Cover,
+			"content":    rev.Content,
+			"authorName": rev.AuthorName,
+			"tags":       rev.Tags,
+			"characters": rev.Characters,
+			"status":     backstoryDraft,
+			"updatedAt":  now,
+		}
+	}
+	res, err := repository.DB().Collection("backstories").UpdateOne(c, filter, bson.M{"$set": set})
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	if res.MatchedCount == 0 {
+		respond(c, http.StatusConflict, "status changed, retry", nil)
+		return
+	}
+	respond(c, http.StatusOK, "success", nil)
+}
+
+// apply 将请求中传入的字段写入修订内容
+func (req backstoryReq) apply(rev *model.BackstoryRevision) error {
+	if req.Title != nil {
+		if strings.TrimSpace(*req.Title) == "" {
+			return errors.New("title required")
+		}
+		rev.Title = strings.TrimSpace(*req.Title)
+	}
+	if req.Subtitle != nil {
+		rev.Subtitle = *req.Subtitle
+	}
+	if req.Content != nil {
+		rev.Content = *req.Content
+	}
+	if req.AuthorName != nil {
+		rev.AuthorName = *req.AuthorName
+	}
+	if req.Cover != nil {
+		rev.Cover = req.Cover
+	}
+	if req.Tags != nil {
+		rev.Tags = normalizeTags(req.Tags)
+	}
+	if req.Characters != nil {
+		chars, err := normalizeCharacters(req.Characters)
+		if err != nil {
+			return err
+		}
+		rev.Characters = chars
+	}
+	return nil
+}
+
+// backstoryRevisionOf 以剧本当前内容作为修订稿底稿
+func backstoryRevisionOf(b model.Backstory) model.BackstoryRevision {
+	return model.BackstoryRevision{
+		Title:      b.Title,
+		Subtitle:   b.Subtitle,
+		Cover:      b.Cover,
+		Content:    b.Content,
+		AuthorName: b.AuthorName,
+		Tags:       b.Tags,
+		Characters: b.Characters,
+		Status:     backstoryDraft,
+	}
+}
+
+// BackfillBackstoryStatus 早期剧本没有审核状态，视为已通过（启动时执行，已有状态的不受影响）
+func BackfillBackstoryStatus(ctx context.Context) error {
+	_, err := repository.DB().Collection("backstories").UpdateMany(ctx,
+		bson.M{"status": bson.M{"$in": []interface{}{nil, ""}}},
+		bson.M{"$set": bson.M{"status": backstoryApproved}})
+	return err
+}
+
+// DeleteBackstory 删除剧本（仅作者，软删除）
+func DeleteBackstory(c *gin.Context) {
+	userId := c.GetString("userId")
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	now := time.Now()
+	res, err := repository.DB().Collection("backstories").UpdateOne(c,
+		bson.M{"_id": oid, "authorUserId": userId, "deletedAt": nil},
+		bson.M{"$set": bson.M{"deletedAt": now, "updatedAt": now}})
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	if res.MatchedCount == 0 {
+		respond(c, http.StatusForbidden, "forbidden or not found", nil)
+		return
+	}
+	respond(c, http.StatusOK, "success", nil)
+}
+
+// queryTags 兼容 ?tags=a&tags=b 与 ?tags=a,b 两种写法
+func queryTags(c *gin.Context) []string {
+	var raw []string
+	for _, v := range c.QueryArray("tags") {
+		raw = append(raw, strings.Split(v, ",")...)
+	}
+	return normalizeTags(raw)
+}
+
+// normalizeTags 去除空白与重复标签
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
+}
+
+// normalizeCharacters 校验角色名并为缺少 ID 的角色生成 ID（同一剧本内唯一）
+func normalizeCharacters(chars []model.BackstoryCharacter) ([]model.BackstoryCharacter, error) {
+	seen := make(map[string]bool, len(chars))
+	out := make([]model.BackstoryCharacter, 0, len(chars))
+	for _, ch := range chars {
+		ch.Name = strings.TrimSpace(ch.Name)
+		if ch.Name == "" {
+			return nil, errors.New("character name required")
+		}
+		if ch.CharacterId == "" {
+			ch.CharacterId = uuid.NewString()
+		}
+		if seen[ch.CharacterId] {
+			return nil, errors.New("duplicate character_id")
+		}
+		seen[ch.CharacterId] = true
+		out = append(out, ch)
+	}
+	return out, nil
+}
@@ -0,0 +1,222 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"actiondelta/internal/model"
+	"actiondelta/internal/repository"
+)
+
+// SubmitBackstory 作者投送剧本进入审核队列（草稿或被驳回的剧本可投送；已通过的剧本投送其修订稿）
+func SubmitBackstory(c *gin.Context) {
+	userId := c.GetString("userId")
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	var b model.Backstory
+	if err := repository.DB().Collection("backstories").FindOne(c, bson.M{"_id": oid, "authorUserId": userId, "deletedAt": nil}).Decode(&b); err != nil {
+		respond(c, http.StatusForbidden, "forbidden or not found", nil)
+		return
+	}
+	if b.Status == backstoryApproved && b.Revision != nil {
+		submitBackstoryRevision(c, b)
+		return
+	}
+	if b.Status != backstoryDraft && b.Status != backstoryRejected && b.Status != "" {
+		respond(c, http.StatusConflict, "already "+b.Status, nil)
+		return
+	}
+	if len(b.Characters) == 0 {
+		respond(c, http.StatusBadRequest, "at least one character required", nil)
+		return
+	}
+	now := time.Now()
+	res, err := repository.DB().Collection("backstories").UpdateOne(c,
+		bson.M{"_id": oid, "status": b.Status},
+		bson.M{"$set": bson.M{"status": backstorySubmitted, "submittedAt": now, "updatedAt": now}})
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	if res.MatchedCount == 0 {
+		respond(c, http.StatusConflict, "status changed, retry", nil)
+		return
+	}
+	_, _ = repository.DB().Collection("user_activities").InsertOne(c, model.UserActivity{UserId: userId, ActivityType: "submit_backstory", TargetType: "backstory", TargetId: oid.Hex(), Title: "投送了剧本", Content: b.Title, CreatedAt: now})
+	respond(c, http.StatusOK, "success", gin.H{"status": backstorySubmitted})
+}
+
+// submitBackstoryRevision 投送已通过剧本的修订稿（草稿或被驳回的修订稿可投送），原内容在审核期间保持公开
+func submitBackstoryRevision(c *gin.Context, b model.Backstory) {
+	rev := b.Revision
+	if rev.Status != backstoryDraft && rev.Status != backstoryRejected {
+		respond(c, http.StatusConflict, "already "+rev.Status, nil)
+		return
+	}
+	if len(rev.Characters) == 0 {
+		respond(c, http.StatusBadRequest, "at least one character required", nil)
+		return
+	}
+	now := time.Now()
+	res, err := repository.DB().Collection("backstories").UpdateOne(c,
+		bson.M{"_id": b.ID, "status": backstoryApproved, "revision.status": rev.Status},
+		bson.M{"$set": bson.M{"revision.status": backstorySubmitted, "revision.submittedAt": now, "revision.updatedAt": now}})
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	if res.MatchedCount == 0 {
+		respond(c, http.StatusConflict, "status changed, retry", nil)
+		return
+	}
+	_, _ = repository.DB().Collection("user_activities").InsertOne(c, model.UserActivity{UserId: b.AuthorUserId, ActivityType: "submit_backstory", TargetType: "backstory", TargetId: b.ID.Hex(), Title: "投送了剧本修订", Content: rev.Title, CreatedAt: now})
+	respond(c, http.StatusOK, "success", gin.H{"status": backstorySubmitted})
+}
+
+// ListBackstoryReviews 管理端审核队列（默认待审核，按投送时间先后；待审核含已通过剧本的修订稿）
+func ListBackstoryReviews(c *gin.Context) {
+	page := parseIntDefault(c.DefaultQuery("page", "1"), 1)
+	size := parseIntDefault(c.DefaultQuery("size", "20"), 20)
+	status := c.DefaultQuery("status", backstorySubmitted)
+
+	filter := bson.M{"deletedAt": nil, "status": status}
+	if status == backstorySubmitted {
+		delete(filter, "status")
+		filter["$or"] = []bson.M{{"status": backstorySubmitted}, {"revision.status": backstorySubmitted}}
+	}
+	col := repository.DB().Collection("backstories")
+	total, _ := col.CountDocuments(c, filter)
+	cur, err := col.Find(c, filter, options.Find().SetSort(bson.M{"submittedAt": 1}).SetSkip(int64((page-1)*size)).SetLimit(int64(size)))
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "查询失败", nil)
+		return
+	}
+	var list []model.Backstory
+	_ = cur.All(c, &list)
+	respond(c, http.StatusOK, "success", gin.H{"total": total, "list": list})
+}
+
+// ReviewBackstory 管理员审核剧本（approve/reject），并通知作者。
+// 已通过剧本的修订稿：通过后覆盖剧本内容，驳回则原内容保持公开、修订稿标记为 rejected。
+func ReviewBackstory(c *gin.Context) {
+	reviewer := c.GetString("userId")
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	var body struct {
+		Action  string `json:"action"` // approve|reject
+		Comment string `json:"comment"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || (body.Action != "approve" && body.Action != "reject") {
+		respond(c, http.StatusBadRequest, "invalid request", nil)
+		return
+	}
+	comment := strings.TrimSpace(body.Comment)
+	if body.Action == "reject" && comment == "" {
+		respond(c, http.StatusBadRequest, "comment required when rejecting", nil)
+		return
+	}
+	newStatus := map[string]string{"approve": backstoryApproved, "reject": backstoryRejected}[body.Action]
+	var cur model.Backstory
+	if err := repository.DB().Collection("backstories").FindOne(c, bson.M{"_id": oid, "deletedAt": nil}).Decode(&cur); err == nil &&
+		cur.Status == backstoryApproved && cur.Revision != nil && cur.Revision.Status == backstorySubmitted {
+		reviewBackstoryRevision(c, cur, reviewer, newStatus, comment)
+		return
+	}
+	now := time.Now()
+	after := options.After
+	var b model.Backstory
+	err = repository.DB().Collection("backstories").FindOneAndUpdate(c,
+		bson.M{"_id": oid, "status": backstorySubmitted, "deletedAt": nil},
+		bson.M{"$set": bson.M{
+			"status":           newStatus,
+			"reviewComment":    comment,
+			"reviewedAt":       now,
+			"reviewedByUserId": reviewer,
+			"updatedAt":        now,
+		}},
+		&options.FindOneAndUpdateOptions{ReturnDocument: &after},
+	).Decode(&b)
+	if err != nil {
+		respond(c, http.StatusNotFound, "not found or not under review", nil)
+		return
+	}
+
+	title := "剧本《" + b.Title + "》审核通过"
+	if newStatus == backstoryRejected {
+		title = "剧本《" + b.Title + "》未通过审核"
+	}
+	notify(c, model.Notification{
+		UserId:     b.AuthorUserId,
+		Type:       "backstory_review",
+		Title:      title,
+		Content:    comment,
+		TargetType: "backstory",
+		TargetId:   oid.Hex(),
+	})
+	respond(c, http.StatusOK, "success", gin.H{"status": newStatus})
+}
+
+// reviewBackstoryRevision 审核已通过剧本的修订稿
+func reviewBackstoryRevision(c *gin.Context, b model.Backstory, reviewer, newStatus, comment string) {
+	rev := b.Revision
+	now := time.Now()
+	update := bson.M{"$set": bson.M{
+		"revision.status":        backstoryRejected,
+		"revision.reviewComment": comment,
+		"updatedAt":              now,
+	}}
+	if newStatus == backstoryApproved {
+		update = bson.M{
+			"$set": bson.M{
+				"title":            rev.Title,
+				"subtitle":         rev.Subtitle,
+				"cover":            rev.Cover,
+				"content":          rev.Content,
+				"authorName":       rev.AuthorName,
+				"tags":             rev.Tags,
+				"characters":       rev.Characters,
+				"reviewComment":    comment,
+				"reviewedAt":       now,
+				"reviewedByUserId": reviewer,
+				"updatedAt":        now,
+			},
+			"$unset": bson.M{"revision": ""},
+		}
+	}
+	res, err := repository.DB().Collection("backstories").UpdateOne(c,
+		bson.M{"_id": b.ID, "status": backstoryApproved, "revision.status": backstorySubmitted, "deletedAt": nil}, update)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	if res.MatchedCount == 0 {
+		respond(c, http.StatusNotFound, "not found or not under review", nil)
+		return
+	}
+
+	title := "剧本《" + rev.Title + "》修订审核通过"
+	if newStatus == backstoryRejected {
+		title = "剧本《" + rev.Title + "》修订未通过审核"
+	}
+	notify(c, model.Notification{
+		UserId:     b.AuthorUserId,
+		Type:       "backstory_review",
+		Title:      title,
+		Content:    comment,
+		TargetType: "backstory",
+		TargetId:   b.ID.Hex(),
+	})
+	respond(c, http.StatusOK, "success", gin.H{"status": newStatus})
+}
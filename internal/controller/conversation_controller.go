@@ -0,0 +1,313 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"actiondelta/internal/model"
+	"actiondelta/internal/realtime"
+	"actiondelta/internal/repository"
+)
+
+// conversationItem 会话列表项
+type conversationItem struct {
+	model.Conversation
+	ReadSeq     int64 `json:"read_seq"`
+	UnreadCount int64 `json:"unread_count"`
+	PeerReadSeq int64 `json:"peer_read_seq,omitempty"` // 私聊对方已读位置（已读回执）
+	// UnreadMentions 未读消息中 @我（含 @all）的条数
+	UnreadMentions int64 `json:"unread_mentions"`
+}
+
+// ListConversations 我的会话列表（私聊/群聊/房间），按最近活跃排序并附未读数
+func ListConversations(c *gin.Context) {
+	userId := c.GetString("userId")
+	page := parseIntDefault(c.DefaultQuery("page", "1"), 1)
+	size := parseIntDefault(c.DefaultQuery("size", "20"), 20)
+
+	filter, err := inboxFilter(c, userId)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	col := repository.DB().Collection("conversations")
+	total, _ := col.CountDocuments(c, filter)
+	cur, err := col.Find(c, filter, options.Find().SetSort(bson.M{"updatedAt": -1}).SetSkip(int64((page-1)*size)).SetLimit(int64(size)))
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	var convs []model.Conversation
+	_ = cur.All(c, &convs)
+
+	ids := make([]string, 0, len(convs))
+	for _, cv := range convs {
+		ids = append(ids, cv.ConversationId)
+	}
+	// 批量读取本页会话的已读位置（包含私聊对方的，用于回执）
+	reads := map[string]int64{}
+	if len(ids) > 0 {
+		rc, err := repository.DB().Collection("conversation_reads").Find(c, bson.M{"conversationId": bson.M{"$in": ids}})
+		if err == nil {
+			var rs []model.ConversationRead
+			_ = rc.All(c, &rs)
+			for _, r := range rs {
+				reads[r.ConversationId+"/"+r.UserId] = r.ReadSeq
+			}
+		}
+	}
+	list := make([]conversationItem, 0, len(convs))
+	for _, cv := range convs {
+		item := conversationItem{Conversation: cv, ReadSeq: reads[cv.ConversationId+"/"+userId]}
+		if item.UnreadCount = cv.LastSeq - item.ReadSeq; item.UnreadCount < 0 {
+			item.UnreadCount = 0
+		}
+		if item.UnreadCount > 0 && cv.ConversationType != "dm" {
+			item.UnreadMentions = unreadMentions(c, cv.ConversationId, userId, item.ReadSeq)
+		}
+		if cv.ConversationType == "dm" {
+			for _, p := range cv.Participants {
+				if p != userId {
+					item.PeerReadSeq = reads[cv.ConversationId+"/"+p]
+				}
+			}
+		}
+		list = append(list, item)
+	}
+	respond(c, http.StatusOK, "success", gin.H{"total": total, "list": list, "total_unread": totalUnread(c, filter, userId)})
+}
+
+// OpenDirectConversation 打开（或返回已有的）与某用户的私聊会话，会话 ID 由双方 userId 确定
+func OpenDirectConversation(c *gin.Context) {
+	userId := c.GetString("userId")
+	var body struct {
+		UserId string `json:"user_id"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.UserId == "" || body.UserId == userId {
+		respond(c, http.StatusBadRequest, "invalid request", nil)
+		return
+	}
+	cnt, _ := repository.DB().Collection("users").CountDocuments(c, bson.M{"userId": body.UserId, "deletedAt": nil})
+	if cnt == 0 {
+		respond(c, http.StatusNotFound, "用户不存在", nil)
+		return
+	}
+	if blocked(c, userId, body.UserId) || blocked(c, body.UserId, userId) {
+		respond(c, http.StatusForbidden, "blocked", nil)
+		return
+	}
+	a, b := orderPair(userId, body.UserId)
+	convId := dmConversationId(a, b)
+	col := repository.DB().Collection("conversations")
+	_, err := col.UpdateOne(c, bson.M{"conversationId": convId}, bson.M{"$setOnInsert": bson.M{
+		"conversationType": "dm",
+		"participants":     []string{a, b},
+		"lastSeq":          int64(0),
+		"lastMessage":      "",
+		"updatedAt":        time.Now(),
+	}}, options.Update().SetUpsert(true))
+	// 并发打开同一私聊时唯一索引冲突，读取已创建的会话即可
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	var conv model.Conversation
+	if err := col.FindOne(c, bson.M{"conversationId": convId}).Decode(&conv); err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	respond(c, http.StatusOK, "success", conv)
+}
+
+// dmConversationId 私聊会话 ID（a、b 已按 orderPair 排序，与 seed 数据格式一致）
+func dmConversationId(a, b string) string {
+	return "dm_" + a + "_" + b
+}
+
+// BackfillDMConversations 补齐早期私聊会话的参与者：早期发送时只记录首个发送者，另一方因此无法访问。
+// 参与者取自会话内消息的发送者，不足两人时按 dm_<a>_<b> 格式从会话 ID 解析；仍无法确定双方的会话跳过。
+func BackfillDMConversations(ctx context.Context) error {
+	col := repository.DB().Collection("conversations")
+	cur, err := col.Find(ctx, bson.M{"conversationType": "dm", "participants.1": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"conversationId": 1, "participants": 1}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	skipped := 0
+	for cur.Next(ctx) {
+		var conv model.Conversation
+		if err := cur.Decode(&conv); err != nil {
+			continue
+		}
+		senders, err := repository.DB().Collection("messages").Distinct(ctx, "senderUserId", bson.M{"conversationId": conv.ConversationId})
+		if err != nil {
+			return err
+		}
+		users := append([]string{}, conv.Participants...)
+		for _, s := range senders {
+			if id, ok := s.(string); ok && id != "" && !containsString(users, id) {
+				users = append(users, id)
+			}
+		}
+		if len(users) < 2 {
+			if a, b, ok := parseDMConversationId(ctx, conv.ConversationId); ok && (len(users) == 0 || users[0] == a || users[0] == b) {
+				users = []string{a, b}
+			}
+		}
+		if len(users) != 2 {
+			skipped++
+			continue
+		}
+		a, b := orderPair(users[0], users[1])
+		if _, err := col.UpdateOne(ctx, bson.M{"_id": conv.ID}, bson.M{"$set": bson.M{"participants": []string{a, b}}}); err != nil {
+			return err
+		}
+	}
+	if skipped > 0 {
+		zap.L().Warn("dm conversations without resolvable participants", zap.Int("count", skipped))
+	}
+	return cur.Err()
+}
+
+// parseDMConversationId 按 dm_<a>_<b> 解析私聊双方（userId 本身可能含下划线，逐个切分点核对用户是否存在）
+func parseDMConversationId(ctx context.Context, convId string) (string, string, bool) {
+	rest := strings.TrimPrefix(convId, "dm_")
+	if rest == convId {
+		return "", "", false
+	}
+	users := repository.DB().Collection("users")
+	for i := strings.Index(rest, "_"); i > 0; {
+		a, b := rest[:i], rest[i+1:]
+		if a != b && b != "" {
+			n, err := users.CountDocuments(ctx, bson.M{"userId": bson.M{"$in": []string{a, b}}})
+			if err == nil && n == 2 {
+				return a, b, true
+			}
+		}
+		next := strings.Index(rest[i+1:], "_")
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return "", "", false
+}
+
+// MarkConversationRead 标记会话已读到 seq（缺省为最新）；已读位置只前进不后退
+func MarkConversationRead(c *gin.Context) {
+	userId := c.GetString("userId")
+	var body struct {
+		ConversationType string `json:"conversation_type"`
+		ConversationId   string `json:"conversation_id"`
+		Seq              int64  `json:"seq"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.ConversationId == "" {
+		respond(c, http.StatusBadRequest, "invalid request", nil)
+		return
+	}
+	if ok, msg := canAccessConversation(c, userId, body.ConversationType, body.ConversationId); !ok {
+		respond(c, http.StatusForbidden, msg, nil)
+		return
+	}
+	latest := currentSeq(c, body.ConversationId)
+	seq := body.Seq
+	if seq <= 0 || seq > latest {
+		seq = latest
+	}
+	readSeq := advanceRead(c, body.ConversationId, userId, seq)
+	if body.ConversationType == "dm" {
+		realtime.Default.Publish(realtime.ConversationTopic(body.ConversationId), realtime.Event{
+			Type:           realtime.EventRead,
+			ConversationId: body.ConversationId,
+			Seq:            readSeq,
+			Data:           gin.H{"user_id": userId, "read_seq": readSeq},
+		})
+	}
+	respond(c, http.StatusOK, "success", gin.H{"read_seq": readSeq, "unread_count": latest - readSeq})
+}
+
+// advanceRead 将用户在会话中的已读位置推进到 seq，返回推进后的已读位置
+func advanceRead(c *gin.Context, conversationId, userId string, seq int64) int64 {
+	if userId == "" {
+		return 0
+	}
+	after := options.After
+	upsert := true
+	var r model.ConversationRead
+	err := repository.DB().Collection("conversation_reads").FindOneAndUpdate(c,
+		bson.M{"conversationId": conversationId, "userId": userId},
+		bson.M{"$max": bson.M{"readSeq": seq}, "$set": bson.M{"updatedAt": time.Now()}},
+		&options.FindOneAndUpdateOptions{Upsert: &upsert, ReturnDocument: &after},
+	).Decode(&r)
+	if err != nil {
+		return seq
+	}
+	return r.ReadSeq
+}
+
+// inboxFilter 我参与的会话：私聊按 participants，群聊/房间按成员关系
+func inboxFilter(c *gin.Context, userId string) (bson.M, error) {
+	ids := []string{}
+	gc, err := repository.DB().Collection("group_members").Find(c, bson.M{"userId": userId}, options.Find().SetProjection(bson.M{"groupId": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var members []model.GroupMember
+	_ = gc.All(c, &members)
+	for _, m := range members {
+		ids = append(ids, m.GroupId.Hex())
+	}
+	tc, err := repository.DB().Collection("theaters").Find(c, bson.M{"participants.userId": userId}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var rooms []model.Theater
+	_ = tc.All(c, &rooms)
+	for _, t := range rooms {
+		ids = append(ids, t.ID.Hex())
+	}
+	return bson.M{"$or": []bson.M{
+		{"conversationType": "dm", "participants": userId},
+		{"conversationType": bson.M{"$in": []string{"group", "room"}}, "conversationId": bson.M{"$in": ids}},
+	}}, nil
+}
+
+// totalUnread 全部会话的未读总数
+func totalUnread(c *gin.Context, filter bson.M, userId string) int64 {
+	cur, err := repository.DB().Collection("conversations").Aggregate(c, []bson.M{
+		{"$match": filter},
+		{"$lookup": bson.M{
+			"from": "conversation_reads",
+			"let":  bson.M{"cid": "$conversationId"},
+			"pipeline": []bson.M{{"$match": bson.M{"$expr": bson.M{"$and": []bson.M{
+				{"$eq": []interface{}{"$conversationId", "$$cid"}},
+				{"$eq": []interface{}{"$userId", userId}},
+			}}}}},
+			"as": "read",
+		}},
+		{"$project": bson.M{"unread": bson.M{"$max": []interface{}{0, bson.M{"$subtract": []interface{}{
+			"$lastSeq", bson.M{"$ifNull": []interface{}{bson.M{"$arrayElemAt": []interface{}{"$read.readSeq", 0}}, 0}},
+		}}}}}},
+		{"$group": bson.M{"_id": nil, "total": bson.M{"$sum": "$unread"}}},
+	})
+	if err != nil {
+		return 0
+	}
+	var res []struct {
+		Total int64 `bson:"total"`
+	}
+	_ = cur.All(c, &res)
+	if len(res) == 0 {
+		return 0
+	}
+	return res[0].Total
+}
@@ -0,0 +1,285 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"actiondelta/internal/model"
+	"actiondelta/internal/repository"
+	"actiondelta/internal/room"
+)
+
+const (
+	maxPinnedMessages    = 10
+	maxAnnouncementRunes = 2000
+	systemEventPin       = "pin"
+	systemEventUnpin     = "unpin"
+	systemEventAnnounce  = "announcement"
+)
+
+// PinMessage 置顶消息（群主/管理员、房主）
+func PinMessage(c *gin.Context) {
+	userId := c.GetString("userId")
+	m, ok := loadManagedMessage(c, userId)
+	if !ok {
+		return
+	}
+	col := repository.DB().Collection("conversations")
+	res, err := col.UpdateOne(c, bson.M{
+		"conversationId":   m.ConversationId,
+		"pinned.messageId": bson.M{"$ne": m.ID},
+		"pinned." + strconv.Itoa(maxPinnedMessages-1): bson.M{"$exists": false},
+	}, bson.M{"$push": bson.M{"pinned": model.PinnedMessage{MessageId: m.ID, Seq: m.Seq, PinnedBy: userId, PinnedAt: time.Now()}}})
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	if res.MatchedCount == 0 {
+		cnt, _ := col.CountDocuments(c, bson.M{"conversationId": m.ConversationId, "pinned.messageId": m.ID})
+		if cnt == 0 {
+			respond(c, http.StatusConflict, "too many pinned messages", nil)
+			return
+		}
+		// 已置顶，幂等返回
+		respond(c, http.StatusOK, "success", nil)
+		return
+	}
+	postSystemMessage(c, m.ConversationType, m.ConversationId, userId, systemEventPin, nickname(c, userId)+" 置顶了一条消息", m.ID.Hex())
+	respond(c, http.StatusOK, "success", nil)
+}
+
+// UnpinMessage 取消置顶
+func UnpinMessage(c *gin.Context) {
+	userId := c.GetString("userId")
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	// 消息已撤回/删除时仍可取消置顶，故按置顶记录查找会话
+	var conv model.Conversation
+	if err := repository.DB().Collection("conversations").FindOne(c, bson.M{"pinned.messageId": oid}).Decode(&conv); err != nil {
+		respond(c, http.StatusOK, "success", nil)
+		return
+	}
+	if !canManageConversation(c, userId, conv.ConversationType, conv.ConversationId) {
+		respond(c, http.StatusForbidden, "forbidden", nil)
+		return
+	}
+	res, err := repository.DB().Collection("conversations").UpdateOne(c, bson.M{"conversationId": conv.ConversationId},
+		bson.M{"$pull": bson.M{"pinned": bson.M{"messageId": oid}}})
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	if res.ModifiedCount > 0 {
+		postSystemMessage(c, conv.ConversationType, conv.ConversationId, userId, systemEventUnpin, nickname(c, userId)+" 取消了置顶", oid.Hex())
+	}
+	respond(c, http.StatusOK, "success", nil)
+}
+
+// SetAnnouncement 设置会话公告（群主/管理员、房主）；text 为空则清除
+func SetAnnouncement(c *gin.Context) {
+	userId := c.GetString("userId")
+	var body struct {
+		ConversationType string `json:"conversation_type"`
+		ConversationId   string `json:"conversation_id"`
+		Text             string `json:"text"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.ConversationId == "" {
+		respond(c, http.StatusBadRequest, "invalid request", nil)
+		return
+	}
+	text := strings.TrimSpace(body.Text)
+	if utf8.RuneCountInString(text) > maxAnnouncementRunes {
+		respond(c, http.StatusBadRequest, "announcement too long", nil)
+		return
+	}
+	if !canManageConversation(c, userId, body.ConversationType, body.ConversationId) {
+		respond(c, http.StatusForbidden, "forbidden", nil)
+		return
+	}
+	if err := ensureConversation(c, body.ConversationType, body.ConversationId); err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	update := bson.M{"$unset": bson.M{"announcement": ""}}
+	sysText := nickname(c, userId) + " 清除了公告"
+	if text != "" {
+		update = bson.M{"$set": bson.M{"announcement": model.Announcement{Text: text, UpdatedBy: userId, UpdatedAt: time.Now()}}}
+		sysText = nickname(c, userId) + " 更新了公告：" + text
+	}
+	_, err := repository.DB().Collection("conversations").UpdateOne(c, bson.M{"conversationId": body.ConversationId}, update)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	postSystemMessage(c, body.ConversationType, body.ConversationId, userId, systemEventAnnounce, sysText, "")
+	respond(c, http.StatusOK, "success", nil)
+}
+
+// GetConversationDetail 会话详情：公告与置顶消息
+func GetConversationDetail(c *gin.Context) {
+	userId := c.GetString("userId")
+	convType := c.Query("conversation_type")
+	convId := c.Query("conversation_id")
+	if ok, msg := canAccessConversation(c, userId, convType, convId); !ok {
+		respond(c, http.StatusForbidden, msg, nil)
+		return
+	}
+	respond(c, http.StatusOK, "success", conversationDetail(c, userId, convType, convId))
+}
+
+// conversationDetail 会话公告、置顶消息及当前用户是否可管理
+func conversationDetail(c *gin.Context, userId, convType, convId string) gin.H {
+	var conv model.Conversation
+	_ = repository.DB().Collection("conversations").FindOne(c, bson.M{"conversationId": convId}).Decode(&conv)
+	pinned := []model.Message{}
+	if len(conv.Pinned) > 0 {
+		ids := make([]primitive.ObjectID, 0, len(conv.Pinned))
+		for _, p := range conv.Pinned {
+			ids = append(ids, p.MessageId)
+		}
+		cur, err := repository.DB().Collection("messages").Find(c, bson.M{"_id": bson.M{"$in": ids}},
+			options.Find().SetSort(bson.M{"seq": 1}).SetProjection(bson.M{"editHistory": 0, "searchTokens": 0}))
+		if err == nil {
+			_ = cur.All(c, &pinned)
+		}
+		attachPreviews(c, pinned)
+		pinned = renderMessages(pinned, userId)
+	}
+	return gin.H{
+		"conversation_id":   convId,
+		"conversation_type": convType,
+		"announcement":      conv.Announcement,
+		"pinned":            conv.Pinned,
+		"pinned_messages":   pinned,
+		"can_manage":        canManageConversation(c, userId, convType, convId),
+	}
+}
+
+// loadManagedMessage 读取路径参数中的消息并校验当前用户可管理其所在会话
+func loadManagedMessage(c *gin.Context, userId string) (model.Message, bool) {
+	var m model.Message
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return m, false
+	}
+	err = repository.DB().Collection("messages").FindOne(c, bson.M{"_id": oid, "deletedAt": nil, "recalled": bson.M{"$ne": true}}).Decode(&m)
+	if err != nil {
+		respond(c, http.StatusNotFound, "message not found", nil)
+		return m, false
+	}
+	if !canManageConversation(c, userId, m.ConversationType, m.ConversationId) {
+		respond(c, http.StatusForbidden, "forbidden", nil)
+		return m, false
+	}
+	return m, true
+}
+
+// ensureConversation 群聊/房间尚无会话记录（还没有人发过消息）时以当前全部成员创建
+func ensureConversation(c *gin.Context, convType, convId string) error {
+	col := repository.DB().Collection("conversations")
+	if cnt, err := col.CountDocuments(c, bson.M{"conversationId": convId}); err != nil || cnt > 0 {
+		return err
+	}
+	members := []string{}
+	oid, err := primitive.ObjectIDFromHex(convId)
+	if err != nil {
+		return err
+	}
+	switch convType {
+	case "group":
+		cur, err := repository.DB().Collection("group_members").Find(c, bson.M{"groupId": oid}, options.Find().SetProjection(bson.M{"userId": 1}))
+		if err != nil {
+			return err
+		}
+		var list []model.GroupMember
+		if err := cur.All(c, &list); err != nil {
+			return err
+		}
+		for _, m := range list {
+			members = append(members, m.UserId)
+		}
+	case "room":
+		var th model.Theater
+		if err := repository.DB().Collection("theaters").FindOne(c, bson.M{"_id": oid}).Decode(&th); err != nil {
+			return err
+		}
+		for _, p := range th.Participants {
+			members = append(members, p.UserId)
+		}
+	}
+	_, err = col.UpdateOne(c, bson.M{"conversationId": convId}, bson.M{"$setOnInsert": bson.M{
+		"conversationType": convType,
+		"participants":     members,
+		"lastSeq":          int64(0),
+		"lastMessage":      "",
+		"updatedAt":        time.Now(),
+	}}, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+// canManageConversation 群聊：群主/管理员；房间：房主（仅进行中的房间）；私聊不支持置顶与公告
+func canManageConversation(c *gin.Context, userId, convType, convId string) bool {
+	switch convType {
+	case "group":
+		gid, err := primitive.ObjectIDFromHex(convId)
+		if err != nil {
+			return false
+		}
+		cnt, _ := repository.DB().Collection("group_members").CountDocuments(c, bson.M{"groupId": gid, "userId": userId, "role": bson.M{"$in": []string{"owner", "admin"}}})
+		return cnt > 0
+	case "room":
+		oid, err := primitive.ObjectIDFromHex(convId)
+		if err != nil {
+			return false
+		}
+		var th model.Theater
+		if err := repository.DB().Collection("theaters").FindOne(c, bson.M{"_id": oid, "participants.userId": userId}).Decode(&th); err != nil {
+			return false
+		}
+		return room.Writable(th) && roomHostId(c, th) == userId
+	}
+	return false
+}
+
+// roomHostId 房主；早期房间未记录 hostId，取招募发布者
+func roomHostId(c *gin.Context, th model.Theater) string {
+	if th.HostId != "" {
+		return th.HostId
+	}
+	var rec model.Recruit
+	if err := repository.DB().Collection("recruits").FindOne(c, bson.M{"_id": th.RecruitId}).Decode(&rec); err != nil {
+		return ""
+	}
+	return rec.CreatorId
+}
+
+// unpinRemoved 消息撤回/删除后移出置顶
+func unpinRemoved(c *gin.Context, m model.Message) {
+	_, _ = repository.DB().Collection("conversations").UpdateOne(c, bson.M{"conversationId": m.ConversationId},
+		bson.M{"$pull": bson.M{"pinned": bson.M{"messageId": m.ID}}})
+}
+
+// nickname 用户昵称，缺省为 userId
+func nickname(c *gin.Context, userId string) string {
+	var u model.User
+	if err := repository.DB().Collection("users").FindOne(c, bson.M{"userId": userId}).Decode(&u); err == nil && u.Nickname != "" {
+		return u.Nickname
+	}
+	return userId
+}
@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"actiondelta/internal/model"
+	"actiondelta/internal/repository"
+	"actiondelta/internal/room"
+)
+
+// CreateCostume 为某个源角色创建用户皮
+func CreateCostume(c *gin.Context) {
+	userId := c.GetString("userId")
+	var body struct {
+		Nickname    string `json:"nickname"`
+		Avatar      string `json:"avatar"`
+		CharacterId string `json:"character_id"`
+		BackstoryId string `json:"backstory_id"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || strings.TrimSpace(body.Nickname) == "" || body.CharacterId == "" {
+		respond(c, http.StatusBadRequest, "invalid request", nil)
+		return
+	}
+	var u model.User
+	if err := repository.DB().Collection("users").FindOne(c, bson.M{"userId": userId}).Decode(&u); err != nil {
+		respond(c, http.StatusNotFound, "user not found", nil)
+		return
+	}
+	now := time.Now()
+	cos := model.Costume{
+		Nickname:    strings.TrimSpace(body.Nickname),
+		Avatar:      body.Avatar,
+		UserId:      userId,
+		UserOpenId:  u.UserOpenId,
+		CharacterId: body.CharacterId,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	// 指定剧本时校验源角色确实属于该剧本
+	if body.BackstoryId != "" {
+		bid, err := primitive.ObjectIDFromHex(body.BackstoryId)
+		if err != nil {
+			respond(c, http.StatusBadRequest, "invalid backstory id", nil)
+			return
+		}
+		b, err := loadBackstory(c, bid)
+		if err != nil {
+			respond(c, http.StatusBadRequest, "backstory not found", nil)
+			return
+		}
+		if _, ok := room.BuildRoster(b, "", nil)[body.CharacterId]; !ok {
+			respond(c, http.StatusBadRequest, "unknown character", nil)
+			return
+		}
+		cos.BackstoryId = &bid
+	}
+	res, err := repository.DB().Collection("costumes").InsertOne(c, cos)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	cos.ID = res.InsertedID.(primitive.ObjectID)
+	respond(c, http.StatusOK, "success", cos)
+}
+
+// ListMyCostumes 我的用户皮（可按 character_id / backstory_id 筛选）
+func ListMyCostumes(c *gin.Context) {
+	userId := c.GetString("userId")
+	filter := bson.M{"userId": userId, "deletedAt": nil}
+	if cid := c.Query("character_id"); cid != "" {
+		filter["characterId"] = cid
+	}
+	if bs := c.Query("backstory_id"); bs != "" {
+		if oid, err := primitive.ObjectIDFromHex(bs); err == nil {
+			filter["backstoryId"] = oid
+		}
+	}
+	cur, err := repository.DB().Collection("costumes").Find(c, filter, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	var list []model.Costume
+	_ = cur.All(c, &list)
+	respond(c, http.StatusOK, "success", gin.H{"list": list})
+}
+
+// UpdateCostume 修改用户皮昵称/头像（同步到正在使用该皮的房间）
+func UpdateCostume(c *gin.Context) {
+	userId := c.GetString("userId")
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	var body struct {
+		Nickname *string `json:"nickname"`
+		Avatar   *string `json:"avatar"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respond(c, http.StatusBadRequest, "invalid request", nil)
+		return
+	}
+	set := bson.M{"updatedAt": time.Now()}
+	if body.Nickname != nil {
+		if strings.TrimSpace(*body.Nickname) == "" {
+			respond(c, http.StatusBadRequest, "nickname required", nil)
+			return
+		}
+		set["nickname"] = strings.TrimSpace(*body.Nickname)
+	}
+	if body.Avatar != nil {
+		set["avatar"] = *body.Avatar
+	}
+	cos, err := updateCostume(c, oid, userId, set)
+	if err != nil {
+		respond(c, http.StatusForbidden, "forbidden or not found", nil)
+		return
+	}
+	respond(c, http.StatusOK, "success", cos)
+}
+
+// UploadCostumeAvatar 上传用户皮头像（与用户头像相同的裁剪压缩流程）
+func UploadCostumeAvatar(c *gin.Context) {
+	userId := c.GetString("userId")
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	cnt, _ := repository.DB().Collection("costumes").CountDocuments(c, bson.M{"_id": oid, "userId": userId, "deletedAt": nil})
+	if cnt == 0 {
+		respond(c, http.StatusForbidden, "forbidden or not found", nil)
+		return
+	}
+	data, msg := readImageUpload(c, maxAvatarSizeBytes)
+	if msg != "" {
+		respond(c, http.StatusBadRequest, msg, nil)
+		return
+	}
+	fullID, thumbID, err := storeSquareImage(c, data, "costume")
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errImageDecode) {
+			status = http.StatusBadRequest
+		}
+		respond(c, status, err.Error(), nil)
+		return
+	}
+	avatarURL := "/api/file/" + fullID.Hex()
+	cos, err := updateCostume(c, oid, userId, bson.M{"avatar": avatarURL, "updatedAt": time.Now()})
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	respond(c, http.StatusOK, "上传成功", gin.H{
+		"costume":       cos,
+		"avatar_url":    avatarURL,
+		"thumbnail_url": "/api/file/" + thumbID.Hex(),
+	})
+}
+
+// DeleteCostume 删除用户皮（软删除，已入房的参与者信息保持不变）
+func DeleteCostume(c *gin.Context) {
+	userId := c.GetString("userId")
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	now := time.Now()
+	res, err := repository.DB().Collection("costumes").UpdateOne(c,
+		bson.M{"_id": oid, "userId": userId, "deletedAt": nil},
+		bson.M{"$set": bson.M{"deletedAt": now, "updatedAt": now}})
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	if res.MatchedCount == 0 {
+		respond(c, http.StatusForbidden, "forbidden or not found", nil)
+		return
+	}
+	respond(c, http.StatusOK, "success", nil)
+}
+
+// updateCostume 更新用户皮并同步进行中房间内使用该皮的参与者展示信息（已结束/归档的房间只读，保留原样）
+func updateCostume(c *gin.Context, id primitive.ObjectID, userId string, set bson.M) (model.Costume, error) {
+	after := options.After
+	var cos model.Costume
+	err := repository.DB().Collection("costumes").FindOneAndUpdate(c,
+		bson.M{"_id": id, "userId": userId, "deletedAt": nil},
+		bson.M{"$set": set},
+		&options.FindOneAndUpdateOptions{ReturnDocument: &after},
+	).Decode(&cos)
+	if err != nil {
+		return cos, err
+	}
+	_, _ = repository.DB().Collection("theaters").UpdateMany(c,
+		bson.M{
+			"status":       bson.M{"$in": []interface{}{room.StatusActive, "", nil}},
+			"participants": bson.M{"$elemMatch": bson.M{"userId": userId, "costumeId": id.Hex()}},
+		},
+		bson.M{"$set": bson.M{"participants.$[p].costumeName": cos.Nickname, "participants.$[p].avatar": cos.Avatar}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"p.userId": userId, "p.costumeId": id.Hex()}}}),
+	)
+	return cos, nil
+}
+
+// loadOwnCostume 读取属于当前用户且未删除的用户皮
+func loadOwnCostume(c *gin.Context, userId, costumeId string) (*model.Costume, *roomError) {
+	oid, err := primitive.ObjectIDFromHex(costumeId)
+	if err != nil {
+		return nil, badRequest("invalid costume id")
+	}
+	var cos model.Costume
+	if err := repository.DB().Collection("costumes").FindOne(c, bson.M{"_id": oid, "userId": userId, "deletedAt": nil}).Decode(&cos); err != nil {
+		return nil, badRequest("costume not found")
+	}
+	return &cos, nil
+}
@@ -17,6 +17,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
+	"actiondelta/internal/auth"
 	"actiondelta/internal/repository"
 )
 
@@ -27,30 +28,70 @@ const (
 // UploadAvatar 头像上传接口：校验、裁剪、压缩并存入 Mongo GridFS。
 func UploadAvatar(c *gin.Context) {
 	userId := c.GetString("userId")
-	file, header, err := c.Request.FormFile("file")
-	if err != nil {
-		respond(c, http.StatusBadRequest, "文件缺失", nil)
+	data, msg := readImageUpload(c, maxAvatarSizeBytes)
+	if msg != "" {
+		respond(c, http.StatusBadRequest, msg, nil)
 		return
 	}
-	if header.Size <= 0 || header.Size > maxAvatarSizeBytes {
-		respond(c, http.StatusBadRequest, "文件大小不合法", nil)
+	fullID, thumbID, err := storeSquareImage(c, data, "avatar")
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errImageDecode) {
+			status = http.StatusBadRequest
+		}
+		respond(c, status, err.Error(), nil)
 		return
 	}
+
+	// 更新用户头像（保存可直接访问的 API URL）
+	avatarURL := "/api/file/" + fullID.Hex()
+	thumbURL := "/api/file/" + thumbID.Hex()
+	if err := updateUserAvatar(c, userId, avatarURL, thumbURL); err != nil {
+		// 不阻断返回
+	}
+
+	respond(c, http.StatusOK, "上传成功", gin.H{
+		"file_id":       fullID.Hex(),
+		"thumb_file_id": thumbID.Hex(),
+		"avatar_url":    avatarURL,
+		"thumbnail_url": thumbURL,
+		"uploaded_at":   time.Now().UTC(),
+	})
+}
+
+var (
+	errImageDecode = errors.New("图片解码失败")
+	errImageEncode = errors.New("图片编码失败")
+	errImageSave   = errors.New("保存失败")
+)
+
+// readImageUpload 读取 multipart 的 file 字段并做大小与格式校验，失败时返回提示文案。
+func readImageUpload(c *gin.Context, maxBytes int64) ([]byte, string) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		return nil, "文件缺失"
+	}
+	defer file.Close()
+	if header.Size <= 0 || header.Size > maxBytes {
+		return nil, "文件大小不合法"
+	}
 	buf := new(bytes.Buffer)
 	if _, err := buf.ReadFrom(file); err != nil {
-		respond(c, http.StatusBadRequest, "读取文件失败", nil)
-		return
+		return nil, "读取文件失败"
 	}
 	data := buf.Bytes()
 	if err := validateImageFile(data); err != nil {
-		respond(c, http.StatusBadRequest, err.Error(), nil)
-		return
+		return nil, err.Error()
 	}
+	return data, ""
+}
+
+// storeSquareImage 裁剪为正方形（最大 1024）并生成 200 缩略图，JPEG 编码后写入 GridFS。
+func storeSquareImage(c *gin.Context, data []byte, prefix string) (fullID, thumbID primitive.ObjectID, err error) {
 	// 解码
 	img, _, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
-		respond(c, http.StatusBadRequest, "图片解码失败", nil)
-		return
+		return fullID, thumbID, errImageDecode
 	}
 	// 裁剪为正方形，限制最大尺寸
 	cropped := cropSquare(img)
@@ -60,45 +101,24 @@ func UploadAvatar(c *gin.Context) {
 	// 编码JPEG
 	var outFull, outThumb bytes.Buffer
 	if err := jpeg.Encode(&outFull, resized, &jpeg.Options{Quality: 85}); err != nil {
-		respond(c, http.StatusInternalServerError, "图片编码失败", nil)
-		return
+		return fullID, thumbID, errImageEncode
 	}
 	if err := jpeg.Encode(&outThumb, thumb, &jpeg.Options{Quality: 80}); err != nil {
-		respond(c, http.StatusInternalServerError, "缩略图编码失败", nil)
-		return
+		return fullID, thumbID, errImageEncode
 	}
 
 	// 保存到 GridFS
-	fullName := "avatar-" + uuid.NewString() + ".jpg"
-	thumbName := "avatar-thumb-" + uuid.NewString() + ".jpg"
-	fullID, err := saveToGridFS(c, outFull.Bytes(), fullName)
-	if err != nil {
-		respond(c, http.StatusInternalServerError, "保存失败", nil)
-		return
+	if fullID, err = saveToGridFS(c, outFull.Bytes(), prefix+"-"+uuid.NewString()+".jpg"); err != nil {
+		return fullID, thumbID, errImageSave
 	}
-	thumbID, err := saveToGridFS(c, outThumb.Bytes(), thumbName)
-	if err != nil {
-		respond(c, http.StatusInternalServerError, "保存失败", nil)
-		return
-	}
-
-	// 更新用户头像（保存可直接访问的 API URL）
-	avatarURL := "/api/file/" + fullID.Hex()
-	thumbURL := "/api/file/" + thumbID.Hex()
-	if err := updateUserAvatar(c, userId, avatarURL, thumbURL); err != nil {
-		// 不阻断返回
+	if thumbID, err = saveToGridFS(c, outThumb.Bytes(), prefix+"-thumb-"+uuid.NewString()+".jpg"); err != nil {
+		return fullID, thumbID, errImageSave
 	}
-
-	respond(c, http.StatusOK, "上传成功", gin.H{
-		"file_id":       fullID.Hex(),
-		"thumb_file_id": thumbID.Hex(),
-		"avatar_url":    avatarURL,
-		"thumbnail_url": thumbURL,
-		"uploaded_at":   time.Now().UTC(),
-	})
+	return fullID, thumbID, nil
 }
 
-// GetFile 按文件ID从 GridFS 流式输出（当前固定 image/jpeg）。
+// GetFile 按文件ID从 GridFS 流式输出。头像等公开文件为 image/jpeg；
+// 聊天媒体仅对所属会话成员开放（Authorization 头或 SignFileURL 签发的 sig 参数），并按上传时识别的类型输出。
 func GetFile(c *gin.Context) {
 	idHex := c.Param("id")
 	oid, err := primitive.ObjectIDFromHex(idHex)
@@ -106,6 +126,33 @@ func GetFile(c *gin.Context) {
 		respond(c, http.StatusBadRequest, "invalid id", nil)
 		return
 	}
+	contentType := "image/jpeg"
+	media, ok, err := chatMediaForFile(c, oid)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	if ok {
+		userId := c.GetString("userId")
+		if sig := c.Query("sig"); userId == "" && sig != "" {
+			if claims, err := auth.ParseFileToken(sig, oid.Hex()); err == nil {
+				userId = claims.Subject
+			}
+		}
+		if userId == "" {
+			respond(c, http.StatusUnauthorized, "missing or invalid token", nil)
+			return
+		}
+		if ok, msg := canAccessConversation(c, userId, media.ConversationType, media.ConversationId); !ok {
+			respond(c, http.StatusForbidden, msg, nil)
+			return
+		}
+		contentType = media.ContentType
+		if media.ThumbFileId != nil && *media.ThumbFileId == oid {
+			contentType = media.ThumbContentType
+		}
+		c.Header("Cache-Control", "private, max-age=86400")
+	}
 	bucket, err := repository.GridFS()
 	if err != nil {
 		respond(c, http.StatusInternalServerError, "storage error", nil)
@@ -117,7 +164,8 @@ func GetFile(c *gin.Context) {
 		return
 	}
 	defer stream.Close()
-	c.Header("Content-Type", "image/jpeg")
+	c.Header("Content-Type", contentType)
+	c.Header("X-Content-Type-Options", "nosniff")
 	c.Status(http.StatusOK)
 	if _, err := io.Copy(c.Writer, stream); err != nil {
 		// 传输中断无需额外处理
@@ -60,6 +60,7 @@ func RemoveGroupMember(c *gin.Context) {
     if err := repository.DB().Collection("groups").FindOne(c, bson.M{"_id": gid}).Decode(&g); err != nil { respond(c, http.StatusNotFound, "group not found", nil); return }
     if target != userId && g.OwnerId != userId { respond(c, http.StatusForbidden, "forbidden", nil); return }
     _, _ = repository.DB().Collection("group_members").DeleteOne(c, bson.M{"groupId": gid, "userId": target})
+    publishMembership(gid.Hex(), target)
     respond(c, http.StatusOK, "success", nil)
 }
 
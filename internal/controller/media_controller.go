@@ -0,0 +1,295 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"actiondelta/internal/auth"
+	"actiondelta/internal/model"
+	"actiondelta/internal/repository"
+)
+
+// 聊天媒体类型（同时也是对应消息元素的 type）
+const (
+	mediaImage   = "image"
+	mediaVoice   = "voice"
+	mediaSticker = "sticker"
+)
+
+const (
+	maxChatImageBytes  = 10 * 1024 * 1024
+	maxStickerBytes    = 1 * 1024 * 1024
+	maxVoiceBytes      = 2 * 1024 * 1024
+	maxVoiceDurationMs = 60 * 1000
+	chatImageMaxSide   = 2048
+	chatThumbMaxSide   = 320
+	stickerMaxSide     = 512
+	// fileURLTTL 聊天媒体签名地址的有效期
+	fileURLTTL = 10 * time.Minute
+)
+
+// UploadChatMedia 上传聊天媒体（multipart：file、kind=image|voice|sticker、conversation_type、conversation_id，语音另需 duration_ms）。
+// 返回的 id 作为消息元素的 data.media_id 发送。
+func UploadChatMedia(c *gin.Context) {
+	userId := c.GetString("userId")
+	kind := c.PostForm("kind")
+	convType := convTypeOrDM(c.PostForm("conversation_type"))
+	convId := c.PostForm("conversation_id")
+	if convId == "" {
+		respond(c, http.StatusBadRequest, "missing conversation_id", nil)
+		return
+	}
+	if ok, msg := canSendConversation(c, userId, convType, convId); !ok {
+		respond(c, http.StatusForbidden, msg, nil)
+		return
+	}
+	media := model.ChatMedia{
+		Kind:             kind,
+		ConversationId:   convId,
+		ConversationType: convType,
+		UploaderId:       userId,
+		CreatedAt:        time.Now(),
+	}
+	var err error
+	switch kind {
+	case mediaImage:
+		err = storeChatImage(c, &media)
+	case mediaSticker:
+		err = storeSticker(c, &media)
+	case mediaVoice:
+		err = storeVoice(c, &media)
+	default:
+		err = errors.New("invalid kind")
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errImageSave) {
+			status = http.StatusInternalServerError
+		}
+		respond(c, status, err.Error(), nil)
+		return
+	}
+	res, err := repository.DB().Collection("chat_media").InsertOne(c, media)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	media.ID = res.InsertedID.(primitive.ObjectID)
+	respond(c, http.StatusOK, "上传成功", gin.H{"media": media, "element": gin.H{"type": kind, "media_id": media.ID.Hex()}})
+}
+
+// storeChatImage 图片：限制最长边并重新编码为 JPEG（同时去除 EXIF），另存缩略图
+func storeChatImage(c *gin.Context, media *model.ChatMedia) error {
+	data, msg := readImageUpload(c, maxChatImageBytes)
+	if msg != "" {
+		return errors.New(msg)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return errImageDecode
+	}
+	full := img
+	if b := img.Bounds(); b.Dx() > chatImageMaxSide || b.Dy() > chatImageMaxSide {
+		full = imaging.Fit(img, chatImageMaxSide, chatImageMaxSide, imaging.Lanczos)
+	}
+	thumb := imaging.Fit(img, chatThumbMaxSide, chatThumbMaxSide, imaging.Lanczos)
+	var outFull, outThumb bytes.Buffer
+	if err := jpeg.Encode(&outFull, full, &jpeg.Options{Quality: 85}); err != nil {
+		return errImageEncode
+	}
+	if err := jpeg.Encode(&outThumb, thumb, &jpeg.Options{Quality: 75}); err != nil {
+		return errImageEncode
+	}
+	fullID, err := saveToGridFS(c, outFull.Bytes(), "chat-"+uuid.NewString()+".jpg")
+	if err != nil {
+		return errImageSave
+	}
+	thumbID, err := saveToGridFS(c, outThumb.Bytes(), "chat-thumb-"+uuid.NewString()+".jpg")
+	if err != nil {
+		return errImageSave
+	}
+	media.FileId, media.ThumbFileId = fullID, &thumbID
+	media.ContentType, media.ThumbContentType = "image/jpeg", "image/jpeg"
+	media.Size = int64(outFull.Len())
+	media.Width, media.Height = full.Bounds().Dx(), full.Bounds().Dy()
+	return nil
+}
+
+// storeSticker 表情：保留原文件（GIF 动图不转码），仅校验尺寸
+func storeSticker(c *gin.Context, media *model.ChatMedia) error {
+	data, msg := readImageUpload(c, maxStickerBytes)
+	if msg != "" {
+		return errors.New(msg)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return errImageDecode
+	}
+	if cfg.Width > stickerMaxSide || cfg.Height > stickerMaxSide {
+		return errors.New("表情尺寸过大")
+	}
+	id, err := saveToGridFS(c, data, "sticker-"+uuid.NewString()+"."+format)
+	if err != nil {
+		return errImageSave
+	}
+	media.FileId = id
+	media.ContentType = "image/" + format
+	media.Size = int64(len(data))
+	media.Width, media.Height = cfg.Width, cfg.Height
+	return nil
+}
+
+// storeVoice 语音：按文件头识别格式，时长由客户端录音时给出
+func storeVoice(c *gin.Context, media *model.ChatMedia) error {
+	duration, err := strconv.Atoi(c.PostForm("duration_ms"))
+	if err != nil || duration <= 0 || duration > maxVoiceDurationMs {
+		return errors.New("语音时长不合法")
+	}
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		return errors.New("文件缺失")
+	}
+	defer file.Close()
+	if header.Size <= 0 || header.Size > maxVoiceBytes {
+		return errors.New("文件大小不合法")
+	}
+	buf := new(bytes.Buffer)
+	if _, err := buf.ReadFrom(file); err != nil {
+		return errors.New("读取文件失败")
+	}
+	contentType := sniffAudio(buf.Bytes())
+	if contentType == "" {
+		return errors.New("不支持的文件格式")
+	}
+	id, err := saveToGridFS(c, buf.Bytes(), "voice-"+uuid.NewString())
+	if err != nil {
+		return errImageSave
+	}
+	media.FileId = id
+	media.ContentType = contentType
+	media.Size = int64(buf.Len())
+	media.DurationMs = duration
+	return nil
+}
+
+// sniffAudio 魔数识别常见录音格式（AMR/AAC/MP3/M4A/OGG/WAV）
+func sniffAudio(data []byte) string {
+	switch {
+	case len(data) < 12:
+		return ""
+	case bytes.HasPrefix(data, []byte("#!AMR")):
+		return "audio/amr"
+	case data[0] == 0xFF && (data[1]&0xF6) == 0xF0:
+		return "audio/aac"
+	case bytes.HasPrefix(data, []byte("ID3")), data[0] == 0xFF && (data[1]&0xE0) == 0xE0:
+		return "audio/mpeg"
+	case bytes.Equal(data[4:8], []byte("ftyp")):
+		return "audio/mp4"
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return "audio/ogg"
+	case bytes.HasPrefix(data, []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE")):
+		return "audio/wav"
+	}
+	return ""
+}
+
+// resolveMediaElement 媒体消息元素只需携带 data.media_id：校验媒体属于发送者且上传到同一会话，
+// 其余字段（地址、尺寸、时长等）由服务端填充。
+func resolveMediaElement(c *gin.Context, convId, userId string, elem *model.MessageElement) *roomError {
+	idHex, _ := elem.Data["media_id"].(string)
+	oid, err := primitive.ObjectIDFromHex(idHex)
+	if err != nil {
+		return badRequest("invalid media_id")
+	}
+	var media model.ChatMedia
+	err = repository.DB().Collection("chat_media").FindOne(c, bson.M{
+		"_id":            oid,
+		"kind":           elem.Type,
+		"conversationId": convId,
+		"uploaderId":     userId,
+	}).Decode(&media)
+	if err != nil {
+		return badRequest("media not found")
+	}
+	elem.Data = mediaElementData(media)
+	return nil
+}
+
+func mediaElementData(m model.ChatMedia) map[string]interface{} {
+	data := map[string]interface{}{
+		"media_id":     m.ID.Hex(),
+		"url":          "/api/file/" + m.FileId.Hex(),
+		"content_type": m.ContentType,
+		"size":         m.Size,
+	}
+	if m.ThumbFileId != nil {
+		data["thumbnail_url"] = "/api/file/" + m.ThumbFileId.Hex()
+	}
+	if m.Width > 0 {
+		data["width"], data["height"] = m.Width, m.Height
+	}
+	if m.DurationMs > 0 {
+		data["duration_ms"] = m.DurationMs
+	}
+	return data
+}
+
+// SignFileURL 为聊天媒体文件签发短期访问地址（仅所属会话成员）。<img>/<audio> 无法携带请求头，
+// 客户端以返回的 url（带仅对该文件有效的 sig 参数）加载，不必把登录令牌放进地址。
+func SignFileURL(c *gin.Context) {
+	userId := c.GetString("userId")
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	media, ok, err := chatMediaForFile(c, oid)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	if !ok {
+		// 公开文件无需签名
+		respond(c, http.StatusOK, "success", gin.H{"url": "/api/file/" + oid.Hex()})
+		return
+	}
+	if ok, msg := canAccessConversation(c, userId, media.ConversationType, media.ConversationId); !ok {
+		respond(c, http.StatusForbidden, msg, nil)
+		return
+	}
+	sig, err := auth.GenerateFileToken(oid.Hex(), userId, fileURLTTL)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	respond(c, http.StatusOK, "success", gin.H{
+		"url":        "/api/file/" + oid.Hex() + "?sig=" + sig,
+		"expires_in": int(fileURLTTL.Seconds()),
+	})
+}
+
+// chatMediaForFile 查找文件所属的聊天媒体；头像等公开文件返回 false。
+// 查询出错时返回 error，调用方须拒绝访问（不能当作公开文件输出）。
+func chatMediaForFile(c *gin.Context, fileId primitive.ObjectID) (model.ChatMedia, bool, error) {
+	var media model.ChatMedia
+	err := repository.DB().Collection("chat_media").FindOne(c, bson.M{"$or": []bson.M{{"fileId": fileId}, {"thumbFileId": fileId}}}).Decode(&media)
+	if err == mongo.ErrNoDocuments {
+		return media, false, nil
+	}
+	if err != nil {
+		return media, false, err
+	}
+	return media, true, nil
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"actiondelta/internal/model"
+	"actiondelta/internal/repository"
+)
+
+// mentionAll @全体成员（仅群主/管理员可用）
+const mentionAll = "all"
+
+// mentionPattern 文本中的 @名称（名称到空白或下一个 @ 为止）
+var mentionPattern = regexp.MustCompile(`@([^\s@]+)`)
+
+// parseMentions 提取文本中被 @ 的名称（userId 或昵称，去重并保持出现顺序）：
+// @ 前紧跟邮箱用字符的不算（避免把 a@b.com 当作 @），名称在除 _ - 外的标点处截断
+func parseMentions(text string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, m := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		prev, _ := utf8.DecodeLastRuneInString(text[:m[0]])
+		if m[0] > 0 && prev < utf8.RuneSelf && (unicode.IsLetter(prev) || unicode.IsDigit(prev) || strings.ContainsRune("._%+-", prev)) {
+			continue
+		}
+		name := text[m[2]:m[3]]
+		if i := strings.IndexFunc(name, func(r rune) bool { return unicode.IsPunct(r) && r != '_' && r != '-' }); i >= 0 {
+			name = name[:i]
+		}
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// resolveMentions 解析并校验群聊/房间消息的 @：文本中的 @userId / @昵称（群聊按用户昵称、房间按参与者展示名匹配）
+// 与客户端随消息提交的 ids 合并，只保留会话成员；@all（或 all=true）仅群主/管理员有效；私聊不处理
+func resolveMentions(c *gin.Context, msg *model.Message, ids []string, all bool) {
+	text, _ := msg.Element.Data["text"].(string)
+	names := parseMentions(text)
+	for _, n := range names {
+		if n == mentionAll {
+			all = true
+		}
+	}
+	ids = normalizeTags(append(append([]string{}, ids...), names...))
+	if len(ids) == 0 && !all {
+		return
+	}
+	members := map[string]bool{}
+	switch msg.ConversationType {
+	case "group":
+		gid, err := primitive.ObjectIDFromHex(msg.ConversationId)
+		if err != nil {
+			return
+		}
+		if len(names) > 0 {
+			// @昵称：换成对应的 userId，是否为群成员由下面统一校验
+			cur, err := repository.DB().Collection("users").Find(c, bson.M{"nickname": bson.M{"$in": names}, "deletedAt": nil},
+				options.Find().SetProjection(bson.M{"userId": 1}))
+			if err == nil {
+				var users []model.User
+				_ = cur.All(c, &users)
+				for _, u := range users {
+					ids = append(ids, u.UserId)
+				}
+			}
+		}
+		cur, err := repository.DB().Collection("group_members").Find(c, bson.M{"groupId": gid, "userId": bson.M{"$in": append(ids, msg.SenderUserId)}})
+		if err != nil {
+			return
+		}
+		var list []model.GroupMember
+		_ = cur.All(c, &list)
+		for _, m := range list {
+			members[m.UserId] = true
+			if m.UserId == msg.SenderUserId && (m.Role == "owner" || m.Role == "admin") {
+				members[mentionAll] = true
+			}
+		}
+	case "room":
+		oid, err := primitive.ObjectIDFromHex(msg.ConversationId)
+		if err != nil {
+			return
+		}
+		var th model.Theater
+		if err := repository.DB().Collection("theaters").FindOne(c, bson.M{"_id": oid}).Decode(&th); err != nil {
+			return
+		}
+		for _, p := range th.Participants {
+			members[p.UserId] = true
+			if p.CostumeName != "" && containsString(names, p.CostumeName) {
+				ids = append(ids, p.UserId)
+			}
+		}
+		delete(members, mentionAll) // 房间不支持 @all
+	default:
+		return
+	}
+	msg.MentionAll = all && members[mentionAll]
+	for _, id := range normalizeTags(ids) {
+		if id != msg.SenderUserId && id != mentionAll && members[id] {
+			msg.Mentions = append(msg.Mentions, id)
+		}
+	}
+}
+
+// notifyMentions 为被 @ 的用户生成提醒通知（@all 时通知除发送者外的全部群成员，批量写入）
+func notifyMentions(c *gin.Context, msg model.Message) {
+	targets := msg.Mentions
+	if msg.MentionAll {
+		gid, err := primitive.ObjectIDFromHex(msg.ConversationId)
+		if err != nil {
+			return
+		}
+		cur, err := repository.DB().Collection("group_members").Find(c, bson.M{"groupId": gid, "userId": bson.M{"$ne": msg.SenderUserId}},
+			options.Find().SetProjection(bson.M{"userId": 1}))
+		if err != nil {
+			return
+		}
+		var list []model.GroupMember
+		_ = cur.All(c, &list)
+		targets = targets[:0:0]
+		for _, m := range list {
+			targets = append(targets, m.UserId)
+		}
+	}
+	list := make([]model.Notification, 0, len(targets))
+	for _, uid := range targets {
+		list = append(list, model.Notification{
+			UserId:     uid,
+			Type:       "mention",
+			Title:      "有人@了你",
+			Content:    summarize(msg),
+			TargetType: "message",
+			TargetId:   msg.ID.Hex(),
+		})
+	}
+	notifyMany(c, list)
+}
+
+// unreadMentions 会话中已读位置之后 @ 我的消息数
+func unreadMentions(c *gin.Context, conversationId, userId string, readSeq int64) int64 {
+	cnt, _ := repository.DB().Collection("messages").CountDocuments(c, bson.M{
+		"conversationId": conversationId,
+		"seq":            bson.M{"$gt": readSeq},
+		"senderUserId":   bson.M{"$ne": userId},
+		"deletedAt":      nil,
+		"recalled":       bson.M{"$ne": true},
+		"$or":            []bson.M{{"mentions": userId}, {"mentionAll": true}},
+	})
+	return cnt
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"time"
@@ -12,15 +13,28 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"actiondelta/internal/model"
+	"actiondelta/internal/realtime"
 	"actiondelta/internal/repository"
+	"actiondelta/internal/room"
+)
+
+// 消息模式：皮上（以所扮演角色发言，仅限房间）/ 皮下（以用户本人发言）/ 系统消息（仅服务端生成）
+const (
+	msgTypeCharacter = "character"
+	msgTypeUser      = "user"
+	msgTypeSystem    = "system"
 )
 
 type sendMsgReq struct {
 	ConversationType string                 `json:"conversation_type"` // dm|group|room
 	ConversationId   string                 `json:"conversation_id"`
-	MessageType      string                 `json:"message_type"`
+	MessageType      string                 `json:"message_type"` // character|user，缺省为 user
 	Element          map[string]interface{} `json:"element"`
 	CharacterId      string                 `json:"character_id"`
+	ReplyToId        string                 `json:"reply_to_id"`      // 回复某条消息（与 quote_id 二选一）
+	QuoteId          string                 `json:"quote_id"`         // 引用某条消息
+	MentionUserIds   []string               `json:"mention_user_ids"` // 被 @ 的 userId（群聊/房间）
+	MentionAll       bool                   `json:"mention_all"`      // @全体成员（仅群聊，群主/管理员）
 }
 
 // SendMessage 发送消息（统一接口，支持私聊/群聊/房间）。
@@ -30,53 +44,136 @@ func SendMessage(c *gin.Context) {
 		respond(c, http.StatusBadRequest, "invalid request", nil)
 		return
 	}
-	// 权限检查
-	if ok, msg := canAccessConversation(c, c.GetString("userId"), req.ConversationType, req.ConversationId); !ok {
-		respond(c, http.StatusForbidden, msg, nil)
-		return
-	}
 	sendMessageInternal(c, req)
 }
 
 func sendMessageInternal(c *gin.Context, req sendMsgReq) {
 	userId := c.GetString("userId")
-	seq, err := nextSeq(c, req.ConversationId)
-	if err != nil {
-		respond(c, http.StatusInternalServerError, "server error", nil)
+	now := time.Now()
+	req.ConversationType = convTypeOrDM(req.ConversationType)
+	// 权限检查
+	if ok, msg := canSendConversation(c, userId, req.ConversationType, req.ConversationId); !ok {
+		respond(c, http.StatusForbidden, msg, nil)
+		return
+	}
+	if req.MessageType == "" {
+		req.MessageType = msgTypeUser
+	}
+	if req.MessageType != msgTypeCharacter && req.MessageType != msgTypeUser {
+		respond(c, http.StatusBadRequest, "invalid message_type", nil)
+		return
+	}
+	elem, rerr := buildElement(c, elementContext{conversationId: req.ConversationId, userId: userId}, req.Element)
+	if rerr != nil {
+		respond(c, rerr.status, rerr.msg, nil)
 		return
 	}
-	now := time.Now()
-	elemType, _ := req.Element["type"].(string)
 	msg := model.Message{
 		ConversationId:   req.ConversationId,
 		ConversationType: req.ConversationType,
-		Seq:              seq,
 		SenderUserId:     userId,
 		MessageType:      req.MessageType,
-		Element:          model.MessageElement{Type: elemType, Data: req.Element},
+		Element:          elem,
+		SearchTokens:     messageSearchTokens(elem),
 		CreatedAt:        now,
 		UpdatedAt:        now,
 	}
-	if req.MessageType == "character" {
-		msg.CharacterInfo = &model.CharacterInfo{CharacterId: req.CharacterId}
+	if req.MessageType == msgTypeCharacter {
+		info, rerr := resolveCharacterInfo(c, req, userId)
+		if rerr != nil {
+			respond(c, rerr.status, rerr.msg, nil)
+			return
+		}
+		msg.CharacterInfo = info
 	}
-	_, err = repository.DB().Collection("messages").InsertOne(c, msg)
+	if rerr := applyMessageRef(c, req, &msg); rerr != nil {
+		respond(c, rerr.status, rerr.msg, nil)
+		return
+	}
+	resolveMentions(c, &msg, req.MentionUserIds, req.MentionAll)
+	msg, err := persistMessage(c, msg)
 	if err != nil {
 		respond(c, http.StatusInternalServerError, "server error", nil)
 		return
 	}
-	upsertConversation(c, req.ConversationId, req.ConversationType, []string{userId}, seq, summarize(msg))
-	respond(c, http.StatusOK, "success", gin.H{"seq": seq})
+	addWordCount(c, msg, 1)
+	notifyMentions(c, msg)
+	addReplyCount(c, msg, 1)
+	respond(c, http.StatusOK, "success", gin.H{"seq": msg.Seq, "id": msg.ID.Hex()})
 }
 
-// GetMessageHistory 按 seq 进行分页查询历史消息。
+// addReplyCount 回复发送/撤回/删除时增减线程根消息的回复数（sign 为 1 或 -1）
+func addReplyCount(c *gin.Context, m model.Message, sign int) {
+	if m.ThreadRootId == nil {
+		return
+	}
+	filter := bson.M{"_id": *m.ThreadRootId}
+	if sign < 0 {
+		filter["replyCount"] = bson.M{"$gt": 0}
+	}
+	_, _ = repository.DB().Collection("messages").UpdateOne(c, filter, bson.M{"$inc": bson.M{"replyCount": sign}})
+}
+
+// persistMessage 分配 seq 并写入消息，随后更新会话摘要并向实时通道推送。
+func persistMessage(c *gin.Context, msg model.Message) (model.Message, error) {
+	seq, err := nextSeq(c, msg.ConversationId)
+	if err != nil {
+		return msg, err
+	}
+	msg.Seq = seq
+	res, err := repository.DB().Collection("messages").InsertOne(c, msg)
+	if err != nil {
+		return msg, err
+	}
+	msg.ID = res.InsertedID.(primitive.ObjectID)
+	upsertConversation(c, msg.ConversationId, msg.ConversationType, []string{msg.SenderUserId}, seq, summarize(msg))
+	advanceRead(c, msg.ConversationId, msg.SenderUserId, seq) // 自己发的消息不计未读
+	realtime.Default.Publish(realtime.ConversationTopic(msg.ConversationId), realtime.Event{
+		Type:           realtime.EventMessage,
+		ConversationId: msg.ConversationId,
+		Seq:            msg.Seq,
+		Data:           msg,
+	})
+	return msg, nil
+}
+
+// postSystemMessage 以操作者身份发送系统消息（置顶、公告等会话事件），元素经注册表的 system 规则规范化。
+func postSystemMessage(c *gin.Context, convType, convId, operatorId, event, text, targetId string) {
+	data, rerr := elementRegistry["system"].normalize(c, elementContext{conversationId: convId, userId: operatorId},
+		map[string]interface{}{"event": event, "text": text, "target_id": targetId})
+	if rerr != nil {
+		return
+	}
+	now := time.Now()
+	_, _ = persistMessage(c, model.Message{
+		ConversationId:   convId,
+		ConversationType: convType,
+		SenderUserId:     operatorId,
+		MessageType:      msgTypeSystem,
+		Element:          model.MessageElement{Type: "system", Data: data},
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	})
+}
+
+// 历史消息分页上限
+const (
+	historyDefaultLimit = 50
+	historyMaxLimit     = 100
+)
+
+// GetMessageHistory 按 seq 分页查询历史消息，返回结果始终按 seq 升序。
+// direction：after（缺省，seq 之后，兼容 lastSeq 参数）/ latest（最新 N 条）/ before（seq 之前）/ around（以 seq 为中心，用于跳转到某条消息）。
 func GetMessageHistory(c *gin.Context) {
 	convType := c.Query("conversation_type")
 	convId := c.Query("conversation_id")
-	var lastSeq int64
-	fmt.Sscan(c.DefaultQuery("lastSeq", "0"), &lastSeq)
-	var limit int64 = 50
-	fmt.Sscan(c.DefaultQuery("limit", "50"), &limit)
+	direction := c.DefaultQuery("direction", "after")
+	var anchor int64
+	fmt.Sscan(c.DefaultQuery("seq", c.DefaultQuery("lastSeq", "0")), &anchor)
+	limit := int64(parseIntDefault(c.DefaultQuery("limit", "50"), historyDefaultLimit))
+	if limit > historyMaxLimit {
+		limit = historyMaxLimit
+	}
 	if convId == "" {
 		respond(c, http.StatusBadRequest, "missing conversation_id", nil)
 		return
@@ -87,23 +184,121 @@ func GetMessageHistory(c *gin.Context) {
 		return
 	}
 	filter := bson.M{"conversationId": convId}
-	if lastSeq > 0 {
-		filter["seq"] = bson.M{"$gt": lastSeq}
+	switch c.Query("mode") {
+	case msgTypeCharacter:
+		filter["messageType"] = msgTypeCharacter
+	case msgTypeUser:
+		// 早期未标注类型的消息按皮下处理
+		filter["messageType"] = bson.M{"$nin": []string{msgTypeCharacter, msgTypeSystem}}
+	case "":
+	default:
+		respond(c, http.StatusBadRequest, "invalid mode", nil)
+		return
+	}
+
+	var (
+		list                  []model.Message
+		moreBefore, moreAfter bool
+		err                   error
+	)
+	switch direction {
+	case "latest":
+		list, moreBefore, err = pageMessages(c, filter, nil, false, limit)
+	case "before":
+		if anchor <= 0 {
+			respond(c, http.StatusBadRequest, "seq required", nil)
+			return
+		}
+		list, moreBefore, err = pageMessages(c, filter, bson.M{"$lt": anchor}, false, limit)
+	case "after":
+		list, moreAfter, err = pageMessages(c, filter, bson.M{"$gt": anchor}, true, limit)
+	case "around":
+		if anchor <= 0 {
+			respond(c, http.StatusBadRequest, "seq required", nil)
+			return
+		}
+		var older []model.Message
+		if older, moreBefore, err = pageMessages(c, filter, bson.M{"$lt": anchor}, false, limit/2); err == nil {
+			list, moreAfter, err = pageMessages(c, filter, bson.M{"$gte": anchor}, true, limit-limit/2)
+			list = append(older, list...)
+		}
+	default:
+		respond(c, http.StatusBadRequest, "invalid direction", nil)
+		return
 	}
-	opts := options.Find().SetSort(bson.M{"seq": 1}).SetLimit(limit)
-	cur, err := repository.DB().Collection("messages").Find(c, filter, opts)
 	if err != nil {
 		respond(c, http.StatusInternalServerError, "server error", nil)
 		return
 	}
-	var list []model.Message
-	_ = cur.All(c, &list)
-	respond(c, http.StatusOK, "success", gin.H{"conversation_type": convType, "conversation_id": convId, "messages": list})
+	// prev_cursor 用于 direction=before 继续向前翻页，next_cursor 用于 direction=after 拉取更新的消息
+	attachPreviews(c, list)
+	attachReactions(c, list, c.GetString("userId"))
+	prevCursor, nextCursor := anchor, anchor
+	if len(list) > 0 {
+		prevCursor, nextCursor = list[0].Seq, list[len(list)-1].Seq
+	}
+	data := gin.H{
+		"conversation_type": convType,
+		"conversation_id":   convId,
+		"messages":          renderMessages(list, c.GetString("userId")),
+		"has_more":          moreBefore || moreAfter,
+		"prev_cursor":       prevCursor,
+		"next_cursor":       nextCursor,
+	}
+	if direction == "around" {
+		data["has_more_before"] = moreBefore
+		data["has_more_after"] = moreAfter
+	}
+	respond(c, http.StatusOK, "success", data)
+}
+
+// pageMessages 按 seq 条件取一页消息（多取一条判断是否还有更多），结果按 seq 升序。
+func pageMessages(c *gin.Context, base bson.M, seqCond bson.M, asc bool, limit int64) ([]model.Message, bool, error) {
+	list := []model.Message{}
+	if limit <= 0 {
+		return list, false, nil
+	}
+	filter := bson.M{}
+	for k, v := range base {
+		filter[k] = v
+	}
+	if seqCond != nil {
+		filter["seq"] = seqCond
+	}
+	order := -1
+	if asc {
+		order = 1
+	}
+	cur, err := repository.DB().Collection("messages").Find(c, filter, options.Find().SetSort(bson.M{"seq": order}).SetLimit(limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if err := cur.All(c, &list); err != nil {
+		return nil, false, err
+	}
+	more := int64(len(list)) > limit
+	if more {
+		list = list[:limit]
+	}
+	if !asc {
+		for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+			list[i], list[j] = list[j], list[i]
+		}
+	}
+	return list, more, nil
 }
 
-// canAccessConversation 针对 group/room 强制验证成员关系；dm 若已有会话且非参与者则拒绝；黑名单拦截 DM。
-func canAccessConversation(c *gin.Context, userId, convType, convId string) (bool, string) {
-	switch convType {
+// convTypeOrDM 未传 conversation_type 的早期客户端按私聊处理
+func convTypeOrDM(convType string) string {
+	if convType == "" {
+		return "dm"
+	}
+	return convType
+}
+
+// canAccessConversation 针对 group/room 强制验证成员关系；dm（含未传类型）须为已打开的会话且为参与者；黑名单拦截 DM。
+func canAccessConversation(c context.Context, userId, convType, convId string) (bool, string) {
+	switch convTypeOrDM(convType) {
 	case "group":
 		gid, err := primitive.ObjectIDFromHex(convId)
 		if err != nil {
@@ -129,37 +324,44 @@ func canAccessConversation(c *gin.Context, userId, convType, convId string) (boo
 			}
 		}
 		return false, "not in room"
-	default: // dm 或未知
+	case "dm":
+		// 私聊须先通过 conversation/dm 打开，不接受客户端自拟的会话 ID
 		var conv model.Conversation
-		err := repository.DB().Collection("conversations").FindOne(c, bson.M{"conversationId": convId}).Decode(&conv)
-		if err == nil {
-			// 会话存在但我不是参与者
-			isPart := false
-			for _, p := range conv.Participants {
-				if p == userId {
-					isPart = true
-					break
-				}
-			}
-			if !isPart {
-				return false, "not a participant"
-			}
-			// DM 黑名单校验：若任一方拉黑另一方，则拒绝
-			if len(conv.Participants) == 2 {
-				other := conv.Participants[0]
-				if other == userId && len(conv.Participants) > 1 {
-					other = conv.Participants[1]
-				}
-				if blocked(c, userId, other) || blocked(c, other, userId) {
-					return false, "blocked"
-				}
+		err := repository.DB().Collection("conversations").FindOne(c, bson.M{"conversationId": convId, "conversationType": "dm"}).Decode(&conv)
+		if err != nil {
+			return false, "conversation not found"
+		}
+		if !containsString(conv.Participants, userId) {
+			return false, "not a participant"
+		}
+		// DM 黑名单校验：若任一方拉黑另一方，则拒绝
+		for _, other := range conv.Participants {
+			if other != userId && (blocked(c, userId, other) || blocked(c, other, userId)) {
+				return false, "blocked"
 			}
 		}
 		return true, ""
+	default:
+		return false, "invalid conversation type"
 	}
 }
 
-func blocked(c *gin.Context, userId, other string) bool {
+// canSendConversation 在可访问的基础上要求会话可写：已结束/归档的房间只读（可查看历史，不可发言）。
+func canSendConversation(c *gin.Context, userId, convType, convId string) (bool, string) {
+	if ok, msg := canAccessConversation(c, userId, convType, convId); !ok {
+		return false, msg
+	}
+	if convType == "room" {
+		oid, _ := primitive.ObjectIDFromHex(convId)
+		var th model.Theater
+		if err := repository.DB().Collection("theaters").FindOne(c, bson.M{"_id": oid}, options.FindOne().SetProjection(bson.M{"status": 1})).Decode(&th); err != nil || !room.Writable(th) {
+			return false, "room ended"
+		}
+	}
+	return true, ""
+}
+
+func blocked(c context.Context, userId, other string) bool {
 	cnt, _ := repository.DB().Collection("blocks").CountDocuments(c, bson.M{"userId": userId, "blockedUserId": other})
 	return cnt > 0
 }
@@ -193,8 +395,54 @@ func upsertConversation(c *gin.Context, conversationId, conversationType string,
 }
 
 func summarize(m model.Message) string {
+	switch {
+	case m.Recalled:
+		return "[消息已撤回]"
+	case m.DeletedAt != nil:
+		return "[消息已删除]"
+	}
+	switch m.Element.Type {
+	case mediaImage:
+		return "[图片]"
+	case mediaVoice:
+		return "[语音]"
+	case mediaSticker:
+		return "[表情]"
+	case "dice":
+		return fmt.Sprintf("[骰子] %v", m.Element.Data["total"])
+	}
 	if t, ok := m.Element.Data["text"].(string); ok {
 		return t
 	}
 	return m.Element.Type
 }
+
+// resolveCharacterInfo 皮上消息的角色展示信息：只能以自己在房间内持有的角色发言，
+// 展示名称与头像取所用用户皮（或源角色）。
+func resolveCharacterInfo(c *gin.Context, req sendMsgReq, userId string) (*model.CharacterInfo, *roomError) {
+	if req.ConversationType != "room" {
+		return nil, badRequest("character messages are only allowed in rooms")
+	}
+	oid, err := primitive.ObjectIDFromHex(req.ConversationId)
+	if err != nil {
+		return nil, badRequest("invalid room id")
+	}
+	var th model.Theater
+	if err := repository.DB().Collection("theaters").FindOne(c, bson.M{"_id": oid}).Decode(&th); err != nil {
+		return nil, &roomError{status: http.StatusNotFound, msg: "room not found"}
+	}
+	for _, p := range th.Participants {
+		if p.UserId != userId {
+			continue
+		}
+		charId := room.CharacterOf(p)
+		if charId == "" {
+			return nil, badRequest("no character held in this room")
+		}
+		if req.CharacterId != "" && req.CharacterId != charId {
+			return nil, badRequest("character not held by sender")
+		}
+		return &model.CharacterInfo{CharacterId: charId, Name: p.CostumeName, Avatar: p.Avatar}, nil
+	}
+	return nil, &roomError{status: http.StatusForbidden, msg: "not in room"}
+}
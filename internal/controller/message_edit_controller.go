@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"actiondelta/internal/config"
+	"actiondelta/internal/model"
+	"actiondelta/internal/realtime"
+	"actiondelta/internal/repository"
+)
+
+// tombstoneType 已撤回/删除消息对外展示的元素类型，data.reason 为 recalled|deleted
+const tombstoneType = "tombstone"
+
+// RecallMessage 撤回消息（仅发送者，且在撤回时限内）
+func RecallMessage(c *gin.Context) {
+	userId := c.GetString("userId")
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	if !canModifyOwnMessage(c, userId, oid) {
+		return
+	}
+	now := time.Now()
+	m, err := changeMessage(c, bson.M{
+		"_id":          oid,
+		"senderUserId": userId,
+		"messageType":  bson.M{"$ne": msgTypeSystem},
+		"deletedAt":    nil,
+		"recalled":     bson.M{"$ne": true},
+		"createdAt":    bson.M{"$gte": now.Add(-config.RecallWindow())},
+	}, bson.M{"$set": bson.M{"recalled": true, "recalledAt": now, "updatedAt": now}})
+	if err != nil {
+		respond(c, http.StatusForbidden, "message not found or recall window expired", nil)
+		return
+	}
+	detachFromCassettes(c, m.ID)
+	unpinRemoved(c, m)
+	addWordCount(c, m, -1)
+	addReplyCount(c, m, -1)
+	respond(c, http.StatusOK, "success", renderMessage(m, userId))
+}
+
+// EditMessage 编辑消息（仅发送者，仅可编辑的元素类型；类型不可变，旧版本写入 editHistory）
+func EditMessage(c *gin.Context) {
+	userId := c.GetString("userId")
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	var body struct {
+		Element        map[string]interface{} `json:"element"`
+		MentionUserIds []string               `json:"mention_user_ids"`
+		MentionAll     bool                   `json:"mention_all"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || len(body.Element) == 0 {
+		respond(c, http.StatusBadRequest, "invalid request", nil)
+		return
+	}
+	var old model.Message
+	if err := repository.DB().Collection("messages").FindOne(c, bson.M{"_id": oid, "senderUserId": userId, "deletedAt": nil, "recalled": bson.M{"$ne": true}}).Decode(&old); err != nil {
+		respond(c, http.StatusForbidden, "forbidden or not found", nil)
+		return
+	}
+	if ok, msg := canSendConversation(c, userId, old.ConversationType, old.ConversationId); !ok {
+		respond(c, http.StatusForbidden, msg, nil)
+		return
+	}
+	elemType, _ := body.Element["type"].(string)
+	if elemType != old.Element.Type {
+		respond(c, http.StatusBadRequest, "element type cannot change", nil)
+		return
+	}
+	if !elementRegistry[elemType].editable {
+		respond(c, http.StatusBadRequest, "element type not editable", nil)
+		return
+	}
+	elem, rerr := buildElement(c, elementContext{conversationId: old.ConversationId, userId: userId}, body.Element)
+	if rerr != nil {
+		respond(c, rerr.status, rerr.msg, nil)
+		return
+	}
+	// 按编辑后的内容重新解析 @
+	edited := old
+	edited.Element = elem
+	edited.Mentions, edited.MentionAll = nil, false
+	resolveMentions(c, &edited, body.MentionUserIds, body.MentionAll)
+	now := time.Now()
+	// 以 updatedAt 做乐观并发控制，避免并发编辑丢失历史版本
+	m, err := changeMessage(c, bson.M{"_id": oid, "updatedAt": old.UpdatedAt, "deletedAt": nil, "recalled": bson.M{"$ne": true}}, bson.M{
+		"$set": bson.M{
+			"element":      elem,
+			"searchTokens": messageSearchTokens(elem),
+			"mentions":     edited.Mentions,
+			"mentionAll":   edited.MentionAll,
+			"editedAt":     now,
+			"updatedAt":    now,
+		},
+		"$push": bson.M{"editHistory": model.MessageEdit{Element: old.Element, EditedAt: now}},
+	})
+	if err != nil {
+		respond(c, http.StatusConflict, "message changed, please retry", nil)
+		return
+	}
+	_, _ = repository.DB().Collection("cassettes").UpdateMany(c, bson.M{"messageIds": m.ID}, bson.M{"$set": bson.M{"updatedAt": now}})
+	addWordCount(c, old, -1)
+	addWordCount(c, m, 1)
+	// 只提醒编辑后新增的 @
+	added := m
+	added.Mentions = nil
+	for _, uid := range m.Mentions {
+		if !containsString(old.Mentions, uid) {
+			added.Mentions = append(added.Mentions, uid)
+		}
+	}
+	added.MentionAll = m.MentionAll && !old.MentionAll
+	notifyMentions(c, added)
+	respond(c, http.StatusOK, "success", renderMessage(m, userId))
+}
+
+// DeleteMessage 删除消息（仅发送者，软删除，历史中显示为墓碑）
+func DeleteMessage(c *gin.Context) {
+	userId := c.GetString("userId")
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	if !canModifyOwnMessage(c, userId, oid) {
+		return
+	}
+	now := time.Now()
+	m, err := changeMessage(c, bson.M{"_id": oid, "senderUserId": userId, "messageType": bson.M{"$ne": msgTypeSystem}, "deletedAt": nil},
+		bson.M{"$set": bson.M{"deletedAt": now, "updatedAt": now}})
+	if err != nil {
+		respond(c, http.StatusForbidden, "forbidden or not found", nil)
+		return
+	}
+	detachFromCassettes(c, m.ID)
+	unpinRemoved(c, m)
+	if !m.Recalled {
+		// 撤回时已扣减
+		addWordCount(c, m, -1)
+		addReplyCount(c, m, -1)
+	}
+	respond(c, http.StatusOK, "success", nil)
+}
+
+// canModifyOwnMessage 撤回/删除前校验发送者仍可在该会话发言（已离开、被移出或房间已结束时只读），失败时已写回响应
+func canModifyOwnMessage(c *gin.Context, userId string, id primitive.ObjectID) bool {
+	var m model.Message
+	err := repository.DB().Collection("messages").FindOne(c, bson.M{"_id": id, "senderUserId": userId},
+		options.FindOne().SetProjection(bson.M{"conversationType": 1, "conversationId": 1})).Decode(&m)
+	if err != nil {
+		respond(c, http.StatusForbidden, "forbidden or not found", nil)
+		return false
+	}
+	if ok, msg := canSendConversation(c, userId, m.ConversationType, m.ConversationId); !ok {
+		respond(c, http.StatusForbidden, msg, nil)
+		return false
+	}
+	return true
+}
+
+// changeMessage 条件更新消息，成功后同步会话摘要并推送 message_updated 事件
+func changeMessage(c *gin.Context, filter, update bson.M) (model.Message, error) {
+	after := options.After
+	var m model.Message
+	err := repository.DB().Collection("messages").FindOneAndUpdate(c, filter, update,
+		&options.FindOneAndUpdateOptions{ReturnDocument: &after}).Decode(&m)
+	if err != nil {
+		return m, err
+	}
+	// 仅当该消息仍是会话最后一条时才更新摘要
+	_, _ = repository.DB().Collection("conversations").UpdateOne(c,
+		bson.M{"conversationId": m.ConversationId, "lastSeq": m.Seq},
+		bson.M{"$set": bson.M{"lastMessage": summarize(m)}})
+	realtime.Default.Publish(realtime.ConversationTopic(m.ConversationId), realtime.Event{
+		Type:           realtime.EventMsgUpdated,
+		ConversationId: m.ConversationId,
+		Seq:            m.Seq,
+		Data:           renderMessage(m, ""), // 广播给所有订阅者，不含编辑历史
+	})
+	return m, nil
+}
+
+// detachFromCassettes 从引用该消息的戏文中移除
+func detachFromCassettes(c *gin.Context, id primitive.ObjectID) {
+	_, _ = repository.DB().Collection("cassettes").UpdateMany(c, bson.M{"messageIds": id},
+		bson.M{"$pull": bson.M{"messageIds": id}, "$set": bson.M{"updatedAt": time.Now()}})
+}
+
+// renderMessage 对外展示给 viewer 的消息：编辑历史仅发送者本人可见；已撤回/删除的消息只保留元信息，内容替换为墓碑
+func renderMessage(m model.Message, viewer string) model.Message {
+	if viewer == "" || viewer != m.SenderUserId {
+		m.EditHistory = nil
+	}
+	if !m.Recalled && m.DeletedAt == nil {
+		if m.Element.Segments == nil {
+			m.Element.Segments = elementSegments(m.Element) // 早期消息未存储片段
+		}
+		return m
+	}
+	reason := "deleted"
+	if m.Recalled {
+		reason = "recalled"
+	}
+	m.Element = model.MessageElement{Type: tombstoneType, Data: map[string]interface{}{"reason": reason}}
+	m.CharacterInfo = nil
+	m.EditHistory = nil
+	m.RefPreview = nil
+	m.Reactions = nil
+	return m
+}
+
+func renderMessages(list []model.Message, viewer string) []model.Message {
+	for i := range list {
+		list[i] = renderMessage(list[i], viewer)
+	}
+	return list
+}
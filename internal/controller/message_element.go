@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"actiondelta/internal/model"
+)
+
+const (
+	// maxElementBytes 客户端提交的 element 序列化后的最大字节数
+	maxElementBytes = 16 * 1024
+	// maxTextRunes 文本消息最大字数
+	maxTextRunes = 4000
+	maxDiceSides = 100
+	maxDiceCount = 10
+)
+
+// elementSpec 一种消息元素的规则：normalize 校验客户端提交的 data 并返回规范化后的 data（仅保留该类型定义的字段）。
+type elementSpec struct {
+	clientSendable bool // 客户端可直接发送（system 仅服务端生成）
+	editable       bool // 发送者可编辑
+	normalize      func(c *gin.Context, ec elementContext, data map[string]interface{}) (map[string]interface{}, *roomError)
+}
+
+// elementContext 规范化元素所需的上下文
+type elementContext struct {
+	conversationId string
+	userId         string
+}
+
+// elementRegistry 已注册的消息元素类型
+var elementRegistry = map[string]elementSpec{
+	"text":       {clientSendable: true, editable: true, normalize: normalizeText},
+	mediaImage:   {clientSendable: true, normalize: normalizeMedia(mediaImage)},
+	mediaVoice:   {clientSendable: true, normalize: normalizeMedia(mediaVoice)},
+	mediaSticker: {clientSendable: true, normalize: normalizeMedia(mediaSticker)},
+	"dice":       {clientSendable: true, normalize: normalizeDice},
+	"system":     {normalize: normalizeSystem},
+}
+
+// unsupportedElement 未注册或客户端不可发送的元素类型，以 422 区别于字段校验失败（400）
+func unsupportedElement(t string) *roomError {
+	types := make([]string, 0, len(elementRegistry))
+	for k, spec := range elementRegistry {
+		if spec.clientSendable {
+			types = append(types, k)
+		}
+	}
+	sort.Strings(types)
+	return &roomError{status: http.StatusUnprocessableEntity, msg: fmt.Sprintf("unsupported element type %q, expected one of: %s", t, strings.Join(types, "|"))}
+}
+
+// buildElement 校验客户端提交的 element 并按注册表规范化
+func buildElement(c *gin.Context, ec elementContext, raw map[string]interface{}) (model.MessageElement, *roomError) {
+	if raw == nil {
+		return model.MessageElement{}, badRequest("element required")
+	}
+	if b, err := json.Marshal(raw); err != nil || len(b) > maxElementBytes {
+		return model.MessageElement{}, badRequest("element too large")
+	}
+	t, _ := raw["type"].(string)
+	spec, ok := elementRegistry[t]
+	if !ok || !spec.clientSendable {
+		return model.MessageElement{}, unsupportedElement(t)
+	}
+	data, rerr := spec.normalize(c, ec, raw)
+	if rerr != nil {
+		return model.MessageElement{}, rerr
+	}
+	elem := model.MessageElement{Type: t, Data: data}
+	elem.Segments = elementSegments(elem)
+	return elem, nil
+}
+
+func normalizeText(_ *gin.Context, _ elementContext, data map[string]interface{}) (map[string]interface{}, *roomError) {
+	text, _ := data["text"].(string)
+	if strings.TrimSpace(text) == "" {
+		return nil, badRequest("text required")
+	}
+	if utf8.RuneCountInString(text) > maxTextRunes {
+		return nil, badRequest("text too long")
+	}
+	return map[string]interface{}{"text": text}, nil
+}
+
+func normalizeMedia(kind string) func(*gin.Context, elementContext, map[string]interface{}) (map[string]interface{}, *roomError) {
+	return func(c *gin.Context, ec elementContext, data map[string]interface{}) (map[string]interface{}, *roomError) {
+		elem := model.MessageElement{Type: kind, Data: data}
+		if rerr := resolveMediaElement(c, ec.conversationId, ec.userId, &elem); rerr != nil {
+			return nil, rerr
+		}
+		return elem.Data, nil
+	}
+}
+
+// normalizeDice 掷骰：客户端只给出面数与个数，点数由服务端生成
+func normalizeDice(_ *gin.Context, _ elementContext, data map[string]interface{}) (map[string]interface{}, *roomError) {
+	sides, ok := intField(data, "sides", 6)
+	if !ok || sides < 2 || sides > maxDiceSides {
+		return nil, badRequest("invalid dice sides")
+	}
+	count, ok := intField(data, "count", 1)
+	if !ok || count < 1 || count > maxDiceCount {
+		return nil, badRequest("invalid dice count")
+	}
+	results := make([]int, count)
+	total := 0
+	for i := range results {
+		results[i] = rand.Intn(sides) + 1
+		total += results[i]
+	}
+	return map[string]interface{}{"sides": sides, "count": count, "results": results, "total": total}, nil
+}
+
+func normalizeSystem(_ *gin.Context, _ elementContext, data map[string]interface{}) (map[string]interface{}, *roomError) {
+	text, _ := data["text"].(string)
+	if text == "" {
+		return nil, badRequest("text required")
+	}
+	event, _ := data["event"].(string)
+	out := map[string]interface{}{"event": event, "text": text}
+	if target, _ := data["target_id"].(string); target != "" {
+		out["target_id"] = target
+	}
+	return out, nil
+}
+
+// intField 读取 JSON 数字字段（缺省返回 def），非整数返回 false
+func intField(data map[string]interface{}, key string, def int) (int, bool) {
+	v, ok := data[key]
+	if !ok || v == nil {
+		return def, true
+	}
+	f, ok := v.(float64)
+	if !ok || f != float64(int(f)) {
+		return 0, false
+	}
+	return int(f), true
+}
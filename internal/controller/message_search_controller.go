@@ -0,0 +1,319 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"actiondelta/internal/model"
+	"actiondelta/internal/repository"
+)
+
+// searchSnippetRunes 搜索结果中关键词前后保留的字数
+const searchSnippetRunes = 30
+
+// searchHit 搜索结果：seq 作为锚点，可配合 message/history?direction=around 跳转
+type searchHit struct {
+	ID               string               `json:"id"`
+	ConversationId   string               `json:"conversation_id"`
+	ConversationType string               `json:"conversation_type"`
+	Seq              int64                `json:"seq"`
+	SenderUserId     string               `json:"sender_user_id"`
+	MessageType      string               `json:"message_type"`
+	CharacterInfo    *model.CharacterInfo `json:"character_info,omitempty"`
+	Snippet          string               `json:"snippet"`
+	CreatedAt        time.Time            `json:"created_at"`
+}
+
+// SearchMessages 消息搜索：指定 conversation_id 时在该会话内搜索，否则在我可访问的全部会话中搜索。
+// 条件：keyword / sender_id / character_id / from / to（RFC3339 或 2006-01-02），至少一项；按时间倒序，last_id 游标分页。
+func SearchMessages(c *gin.Context) {
+	userId := c.GetString("userId")
+	convType := c.Query("conversation_type")
+	convId := c.Query("conversation_id")
+	keyword := strings.TrimSpace(c.Query("keyword"))
+	limit := int64(parseIntDefault(c.DefaultQuery("limit", "20"), 20))
+	if limit > historyMaxLimit {
+		limit = historyMaxLimit
+	}
+
+	filter := bson.M{"deletedAt": nil, "recalled": bson.M{"$ne": true}}
+	if keyword != "" {
+		if tokens := queryTokens(keyword); len(tokens) > 0 {
+			filter["searchTokens"] = bson.M{"$all": tokens}
+		}
+		// 分词只做粗筛，最终以原文包含关键词为准
+		filter["element.data.text"] = bson.M{"$regex": regexp.QuoteMeta(keyword), "$options": "i"}
+	}
+	if v := c.Query("sender_id"); v != "" {
+		filter["senderUserId"] = v
+	}
+	if v := c.Query("character_id"); v != "" {
+		filter["characterInfo.characterId"] = v
+	}
+	created := bson.M{}
+	for param, op := range map[string]string{"from": "$gte", "to": "$lte"} {
+		if v := c.Query(param); v != "" {
+			t, err := parseSearchTime(v, param == "to")
+			if err != nil {
+				respond(c, http.StatusBadRequest, "invalid "+param, nil)
+				return
+			}
+			created[op] = t
+		}
+	}
+	if len(created) > 0 {
+		filter["createdAt"] = created
+	}
+	if len(filter) == 2 {
+		respond(c, http.StatusBadRequest, "at least one search condition required", nil)
+		return
+	}
+	if v := c.Query("last_id"); v != "" {
+		oid, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			respond(c, http.StatusBadRequest, "invalid last_id", nil)
+			return
+		}
+		filter["_id"] = bson.M{"$lt": oid}
+	}
+
+	if convId != "" {
+		if ok, msg := canAccessConversation(c, userId, convType, convId); !ok {
+			respond(c, http.StatusForbidden, msg, nil)
+			return
+		}
+		filter["conversationId"] = convId
+	} else {
+		ids, err := accessibleConversationIds(c, userId)
+		if err != nil {
+			respond(c, http.StatusInternalServerError, "server error", nil)
+			return
+		}
+		filter["conversationId"] = bson.M{"$in": ids}
+	}
+
+	cur, err := repository.DB().Collection("messages").Find(c, filter,
+		options.Find().SetSort(bson.M{"_id": -1}).SetLimit(limit+1).SetProjection(bson.M{"editHistory": 0, "searchTokens": 0}))
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	var msgs []model.Message
+	_ = cur.All(c, &msgs)
+	hasMore := int64(len(msgs)) > limit
+	if hasMore {
+		msgs = msgs[:limit]
+	}
+	hits := make([]searchHit, 0, len(msgs))
+	for _, m := range msgs {
+		hits = append(hits, searchHit{
+			ID:               m.ID.Hex(),
+			ConversationId:   m.ConversationId,
+			ConversationType: m.ConversationType,
+			Seq:              m.Seq,
+			SenderUserId:     m.SenderUserId,
+			MessageType:      m.MessageType,
+			CharacterInfo:    m.CharacterInfo,
+			Snippet:          snippet(summarize(m), keyword),
+			CreatedAt:        m.CreatedAt,
+		})
+	}
+	data := gin.H{"list": hits, "has_more": hasMore}
+	if len(msgs) > 0 {
+		data["last_id"] = msgs[len(msgs)-1].ID.Hex()
+	}
+	respond(c, http.StatusOK, "success", data)
+}
+
+// accessibleConversationIds 我可访问的会话 ID（会话列表范围内，排除存在拉黑关系的私聊）
+func accessibleConversationIds(c *gin.Context, userId string) ([]string, error) {
+	filter, err := inboxFilter(c, userId)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := repository.DB().Collection("conversations").Find(c, filter, options.Find().SetProjection(bson.M{"conversationId": 1, "conversationType": 1, "participants": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var convs []model.Conversation
+	if err := cur.All(c, &convs); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(convs))
+	for _, cv := range convs {
+		if cv.ConversationType == "dm" {
+			if ok, _ := canAccessConversation(c, userId, cv.ConversationType, cv.ConversationId); !ok {
+				continue
+			}
+		}
+		ids = append(ids, cv.ConversationId)
+	}
+	return ids, nil
+}
+
+func parseSearchTime(v string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+	if err != nil {
+		return t, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+// snippet 截取关键词附近的文本
+func snippet(text, keyword string) string {
+	r := []rune(text)
+	start := 0
+	if keyword != "" {
+		if i := runeIndexFold(r, []rune(keyword)); i >= 0 {
+			start = i - searchSnippetRunes
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + 2*searchSnippetRunes + len([]rune(keyword))
+	if end > len(r) {
+		end = len(r)
+	}
+	out := string(r[start:end])
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(r) {
+		out += "…"
+	}
+	return out
+}
+
+// runeIndexFold 忽略大小写查找 sub 在 r 中的位置（按 rune 计，逐字转小写不改变长度），未找到返回 -1
+func runeIndexFold(r, sub []rune) int {
+	for i := 0; i+len(sub) <= len(r); i++ {
+		match := true
+		for j, ch := range sub {
+			if unicode.ToLower(r[i+j]) != unicode.ToLower(ch) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// searchTokens 生成消息的检索词：文本按空白与标点切分后取相邻二字组（bigram），单字片段保留原字。
+// 中文无需分词词典即可按任意子串检索。
+func searchTokens(text string) []string {
+	seen := map[string]bool{}
+	var tokens []string
+	for _, run := range textRuns(text) {
+		if len(run) == 1 {
+			if s := string(run); !seen[s] {
+				seen[s] = true
+				tokens = append(tokens, s)
+			}
+			continue
+		}
+		for i := 0; i+1 < len(run); i++ {
+			if s := string(run[i : i+2]); !seen[s] {
+				seen[s] = true
+				tokens = append(tokens, s)
+			}
+		}
+	}
+	return tokens
+}
+
+// queryTokens 关键词的二字组；单字关键词无法用二字组粗筛，返回空由正则兜底
+func queryTokens(keyword string) []string {
+	var tokens []string
+	for _, run := range textRuns(keyword) {
+		for i := 0; i+1 < len(run); i++ {
+			tokens = append(tokens, string(run[i:i+2]))
+		}
+	}
+	return tokens
+}
+
+// textRuns 小写化后按空白与标点切分
+func textRuns(text string) [][]rune {
+	var runs [][]rune
+	var cur []rune
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			if len(cur) > 0 {
+				runs = append(runs, cur)
+				cur = nil
+			}
+			continue
+		}
+		cur = append(cur, r)
+	}
+	if len(cur) > 0 {
+		runs = append(runs, cur)
+	}
+	return runs
+}
+
+// messageSearchTokens 消息的检索词（仅文本类消息）
+func messageSearchTokens(e model.MessageElement) []string {
+	text, _ := e.Data["text"].(string)
+	if text == "" {
+		return nil
+	}
+	return searchTokens(text)
+}
+
+// BackfillSearchTokens 为早期未生成检索词的文本消息补齐 searchTokens（启动后在后台执行，ctx 取消时中止；已补齐的不会重复处理）。
+func BackfillSearchTokens(ctx context.Context) error {
+	col := repository.DB().Collection("messages")
+	cur, err := col.Find(ctx, bson.M{"searchTokens": bson.M{"$exists": false}, "element.data.text": bson.M{"$type": "string"}},
+		options.Find().SetProjection(bson.M{"element": 1}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	var batch []mongo.WriteModel
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := col.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		batch = batch[:0]
+		return err
+	}
+	for cur.Next(ctx) {
+		var m model.Message
+		if err := cur.Decode(&m); err != nil {
+			continue
+		}
+		batch = append(batch, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": m.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"searchTokens": messageSearchTokens(m.Element)}}))
+		if len(batch) >= 500 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	return cur.Err()
+}
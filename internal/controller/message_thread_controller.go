@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"actiondelta/internal/model"
+	"actiondelta/internal/repository"
+)
+
+// previewMaxRunes 回复/引用摘要的最大字数
+const previewMaxRunes = 60
+
+// GetMessageThread 消息所在线程：根消息及其全部回复（按 seq 升序，after_seq 游标分页）
+func GetMessageThread(c *gin.Context) {
+	userId := c.GetString("userId")
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	var m model.Message
+	if err := repository.DB().Collection("messages").FindOne(c, bson.M{"_id": oid}).Decode(&m); err != nil {
+		respond(c, http.StatusNotFound, "message not found", nil)
+		return
+	}
+	if ok, msg := canAccessConversation(c, userId, m.ConversationType, m.ConversationId); !ok {
+		respond(c, http.StatusForbidden, msg, nil)
+		return
+	}
+	root := m
+	if m.ThreadRootId != nil {
+		if err := repository.DB().Collection("messages").FindOne(c, bson.M{"_id": *m.ThreadRootId}).Decode(&root); err != nil {
+			respond(c, http.StatusNotFound, "thread root not found", nil)
+			return
+		}
+	}
+	var afterSeq int64
+	fmt.Sscan(c.DefaultQuery("after_seq", "0"), &afterSeq)
+	limit := int64(parseIntDefault(c.DefaultQuery("limit", "50"), historyDefaultLimit))
+	if limit > historyMaxLimit {
+		limit = historyMaxLimit
+	}
+	replies, more, err := pageMessages(c, bson.M{"conversationId": root.ConversationId, "threadRootId": root.ID}, bson.M{"$gt": afterSeq}, true, limit)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	attachPreviews(c, replies)
+	attachReactions(c, replies, userId)
+	roots := []model.Message{root}
+	attachReactions(c, roots, userId)
+	root = roots[0]
+	respond(c, http.StatusOK, "success", gin.H{
+		"root":     renderMessage(root, userId),
+		"replies":  renderMessages(replies, userId),
+		"has_more": more,
+	})
+}
+
+// applyMessageRef 处理发送请求中的回复/引用：回复归入被回复消息所在线程
+func applyMessageRef(c *gin.Context, req sendMsgReq, msg *model.Message) *roomError {
+	if req.ReplyToId != "" && req.QuoteId != "" {
+		return badRequest("reply_to_id and quote_id are exclusive")
+	}
+	if req.ReplyToId != "" {
+		ref, rerr := resolveMessageRef(c, req.ConversationId, req.ReplyToId)
+		if rerr != nil {
+			return rerr
+		}
+		root := ref.ID
+		if ref.ThreadRootId != nil {
+			root = *ref.ThreadRootId
+		}
+		msg.ReplyToId = &ref.ID
+		msg.ThreadRootId = &root
+		msg.RefPreview = previewOf(ref)
+	}
+	if req.QuoteId != "" {
+		ref, rerr := resolveMessageRef(c, req.ConversationId, req.QuoteId)
+		if rerr != nil {
+			return rerr
+		}
+		msg.QuoteId = &ref.ID
+		msg.RefPreview = previewOf(ref)
+	}
+	return nil
+}
+
+// resolveMessageRef 校验回复/引用的消息与发送目标处于同一会话且仍可见，返回被引用的消息
+func resolveMessageRef(c *gin.Context, convId, refId string) (model.Message, *roomError) {
+	var ref model.Message
+	oid, err := primitive.ObjectIDFromHex(refId)
+	if err != nil {
+		return ref, badRequest("invalid referenced message id")
+	}
+	err = repository.DB().Collection("messages").FindOne(c, bson.M{
+		"_id":            oid,
+		"conversationId": convId,
+		"deletedAt":      nil,
+		"recalled":       bson.M{"$ne": true},
+	}).Decode(&ref)
+	if err != nil {
+		return ref, badRequest("referenced message not found")
+	}
+	return ref, nil
+}
+
+// attachPreviews 为回复/引用了其他消息的消息批量填充被引用消息的摘要
+func attachPreviews(ctx context.Context, list []model.Message) {
+	ids := []primitive.ObjectID{}
+	for _, m := range list {
+		if id := refId(m); id != nil {
+			ids = append(ids, *id)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	cur, err := repository.DB().Collection("messages").Find(ctx, bson.M{"_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"editHistory": 0}))
+	if err != nil {
+		return
+	}
+	var refs []model.Message
+	_ = cur.All(ctx, &refs)
+	byId := make(map[primitive.ObjectID]model.Message, len(refs))
+	for _, r := range refs {
+		byId[r.ID] = r
+	}
+	for i := range list {
+		id := refId(list[i])
+		if id == nil {
+			continue
+		}
+		if r, ok := byId[*id]; ok {
+			list[i].RefPreview = previewOf(r)
+		} else {
+			list[i].RefPreview = &model.MessagePreview{ID: *id, Unavailable: true}
+		}
+	}
+}
+
+func refId(m model.Message) *primitive.ObjectID {
+	if m.ReplyToId != nil {
+		return m.ReplyToId
+	}
+	return m.QuoteId
+}
+
+// previewOf 生成消息摘要；已撤回/删除的消息只保留元信息
+func previewOf(m model.Message) *model.MessagePreview {
+	p := &model.MessagePreview{ID: m.ID, Seq: m.Seq, SenderUserId: m.SenderUserId, MessageType: m.MessageType, Text: summarize(m)}
+	if m.Recalled || m.DeletedAt != nil {
+		p.Unavailable = true
+		return p
+	}
+	p.CharacterInfo = m.CharacterInfo
+	if r := []rune(p.Text); len(r) > previewMaxRunes {
+		p.Text = string(r[:previewMaxRunes]) + "…"
+	}
+	return p
+}
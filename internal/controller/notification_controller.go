@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"actiondelta/internal/model"
+	"actiondelta/internal/repository"
+)
+
+// notify 写入一条站内通知（失败仅记录日志，不阻断主流程）
+func notify(c *gin.Context, n model.Notification) {
+	n.Read = false
+	n.CreatedAt = time.Now()
+	if _, err := repository.DB().Collection("notifications").InsertOne(c, n); err != nil {
+		zap.L().Warn("insert notification", zap.String("userId", n.UserId), zap.Error(err))
+	}
+}
+
+// notifyBatch 单次批量写入的通知条数
+const notifyBatch = 500
+
+// notifyMany 批量写入站内通知（如 @all 的群成员扇出），按 notifyBatch 分批，失败仅记录日志
+func notifyMany(c *gin.Context, list []model.Notification) {
+	now := time.Now()
+	for len(list) > 0 {
+		n := len(list)
+		if n > notifyBatch {
+			n = notifyBatch
+		}
+		docs := make([]interface{}, 0, n)
+		for _, item := range list[:n] {
+			item.Read = false
+			item.CreatedAt = now
+			docs = append(docs, item)
+		}
+		if _, err := repository.DB().Collection("notifications").InsertMany(c, docs, options.InsertMany().SetOrdered(false)); err != nil {
+			zap.L().Warn("insert notifications", zap.Int("count", n), zap.Error(err))
+		}
+		list = list[n:]
+	}
+}
+
+// ListNotifications 我的通知（游标分页，附未读数）
+func ListNotifications(c *gin.Context) {
+	userId := c.GetString("userId")
+	lastId := c.Query("last_id")
+	limit := int64(20)
+
+	filter := bson.M{"userId": userId}
+	if c.Query("unread") == "true" {
+		filter["read"] = false
+	}
+	if lastId != "" {
+		if oid, err := primitive.ObjectIDFromHex(lastId); err == nil {
+			filter["_id"] = bson.M{"$lt": oid}
+		}
+	}
+	col := repository.DB().Collection("notifications")
+	cur, err := col.Find(c, filter, options.Find().SetSort(bson.M{"_id": -1}).SetLimit(limit))
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "查询失败", nil)
+		return
+	}
+	var list []model.Notification
+	_ = cur.All(c, &list)
+	next := ""
+	if len(list) > 0 {
+		next = list[len(list)-1].ID.Hex()
+	}
+	unread, _ := col.CountDocuments(c, bson.M{"userId": userId, "read": false})
+	respond(c, http.StatusOK, "success", gin.H{"notifications": list, "next_cursor": next, "unread_count": unread})
+}
+
+// MarkNotificationsRead 标记通知已读（ids 为空时全部标记）
+func MarkNotificationsRead(c *gin.Context) {
+	userId := c.GetString("userId")
+	var body struct {
+		Ids []string `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respond(c, http.StatusBadRequest, "invalid request", nil)
+		return
+	}
+	filter := bson.M{"userId": userId, "read": false}
+	if len(body.Ids) > 0 {
+		oids := make([]primitive.ObjectID, 0, len(body.Ids))
+		for _, id := range body.Ids {
+			if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+				oids = append(oids, oid)
+			}
+		}
+		filter["_id"] = bson.M{"$in": oids}
+	}
+	res, err := repository.DB().Collection("notifications").UpdateMany(c, filter, bson.M{"$set": bson.M{"read": true}})
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	respond(c, http.StatusOK, "success", gin.H{"updated": res.ModifiedCount})
+}
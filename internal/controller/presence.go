@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"actiondelta/internal/config"
+	"actiondelta/internal/model"
+	"actiondelta/internal/realtime"
+	"actiondelta/internal/repository"
+)
+
+// presenceInfo 在线状态快照/变更事件内容
+type presenceInfo struct {
+	UserId     string    `json:"user_id"`
+	Online     bool      `json:"online"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+// openPresence 实时连接建立：用户在本实例的第一条连接登记到 onlineInstances，此前不在任何实例上时上线并广播。
+func openPresence(ctx context.Context, userId string) {
+	if !realtime.Connect(userId) {
+		return
+	}
+	var before model.User
+	err := repository.DB().Collection("users").FindOneAndUpdate(ctx, bson.M{"userId": userId},
+		bson.M{"$addToSet": bson.M{"onlineInstances": config.InstanceID()}},
+		options.FindOneAndUpdate().SetProjection(bson.M{"onlineInstances": 1})).Decode(&before)
+	if err == nil && len(before.Instances) == 0 {
+		setPresence(ctx, userId, true)
+	}
+}
+
+// closePresence 实时连接断开：用户在本实例的最后一条连接断开时注销本实例，已不在任何实例上时记录离线时间并广播。
+func closePresence(userId string) {
+	if !realtime.Disconnect(userId) {
+		return
+	}
+	// 请求上下文此时可能已取消，单独给出超时
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _ = repository.DB().Collection("users").UpdateOne(ctx, bson.M{"userId": userId},
+		bson.M{"$pull": bson.M{"onlineInstances": config.InstanceID()}})
+	setPresence(ctx, userId, false)
+}
+
+// setPresence 写入在线状态并广播；下线仅在用户已不在任何实例上时生效
+func setPresence(ctx context.Context, userId string, online bool) {
+	now := time.Now()
+	filter := bson.M{"userId": userId}
+	if !online {
+		filter["onlineInstances.0"] = bson.M{"$exists": false}
+	}
+	res, err := repository.DB().Collection("users").UpdateOne(ctx, filter, bson.M{"$set": bson.M{"online": online, "lastSeenAt": now}})
+	if err != nil || res.MatchedCount == 0 {
+		return
+	}
+	realtime.Default.Publish(realtime.PresenceTopic(userId), realtime.Event{
+		Type: realtime.EventPresence,
+		Data: presenceInfo{UserId: userId, Online: online, LastSeenAt: now},
+	})
+}
+
+// loadPresence 读取用户当前在线状态
+func loadPresence(ctx context.Context, userId string) presenceInfo {
+	var u model.User
+	_ = repository.DB().Collection("users").FindOne(ctx, bson.M{"userId": userId}).Decode(&u)
+	return presenceInfo{UserId: userId, Online: u.Online, LastSeenAt: u.LastSeenAt}
+}
+
+// canWatchPresence 只能订阅自己、好友或同一房间参与者的在线状态
+func canWatchPresence(ctx context.Context, userId, other string) bool {
+	if userId == other {
+		return true
+	}
+	a, b := orderPair(userId, other)
+	if cnt, _ := repository.DB().Collection("friends").CountDocuments(ctx, bson.M{"userA": a, "userB": b}); cnt > 0 {
+		return true
+	}
+	cnt, _ := repository.DB().Collection("theaters").CountDocuments(ctx, bson.M{"participants.userId": bson.M{"$all": []string{userId, other}}})
+	return cnt > 0
+}
+
+// publishFriendshipChange 通知双方的在线状态订阅复核可见性（如解除好友、拉黑）
+func publishFriendshipChange(a, b string) {
+	realtime.Default.Publish(realtime.PresenceTopic(a), realtime.Event{Type: realtime.EventMembership, Data: b})
+	realtime.Default.Publish(realtime.PresenceTopic(b), realtime.Event{Type: realtime.EventMembership, Data: a})
+}
+
+// ResetPresence 服务启动时清除本实例上次异常退出遗留的在线标记（连接计数仅存在于进程内）；
+// 其他实例上的连接不受影响，已不在任何实例上的用户标记为离线。
+func ResetPresence(ctx context.Context) error {
+	col := repository.DB().Collection("users")
+	id := config.InstanceID()
+	if _, err := col.UpdateMany(ctx, bson.M{"onlineInstances": id}, bson.M{"$pull": bson.M{"onlineInstances": id}}); err != nil {
+		return err
+	}
+	_, err := col.UpdateMany(ctx, bson.M{"online": true, "onlineInstances.0": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"online": false}})
+	return err
+}
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"actiondelta/internal/model"
+	"actiondelta/internal/realtime"
+	"actiondelta/internal/repository"
+)
+
+// maxEmojiRunes 单个表情最多的码点数（组合表情由多个码点构成）
+const maxEmojiRunes = 16
+
+// AddReaction 对消息添加表情回应（重复添加幂等）
+func AddReaction(c *gin.Context) {
+	var body struct {
+		Emoji string `json:"emoji"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respond(c, http.StatusBadRequest, "invalid request", nil)
+		return
+	}
+	changeReaction(c, body.Emoji, true)
+}
+
+// RemoveReaction 取消表情回应（emoji 通过查询参数传入）
+func RemoveReaction(c *gin.Context) {
+	changeReaction(c, c.Query("emoji"), false)
+}
+
+func changeReaction(c *gin.Context, emoji string, add bool) {
+	userId := c.GetString("userId")
+	emoji = strings.TrimSpace(emoji)
+	if emoji == "" || utf8.RuneCountInString(emoji) > maxEmojiRunes {
+		respond(c, http.StatusBadRequest, "invalid emoji", nil)
+		return
+	}
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	var m model.Message
+	if err := repository.DB().Collection("messages").FindOne(c, bson.M{"_id": oid, "deletedAt": nil, "recalled": bson.M{"$ne": true}}).Decode(&m); err != nil {
+		respond(c, http.StatusNotFound, "message not found", nil)
+		return
+	}
+	if ok, msg := canSendConversation(c, userId, m.ConversationType, m.ConversationId); !ok {
+		respond(c, http.StatusForbidden, msg, nil)
+		return
+	}
+	col := repository.DB().Collection("message_reactions")
+	changed := false
+	if add {
+		_, err = col.InsertOne(c, model.MessageReaction{MessageId: m.ID, ConversationId: m.ConversationId, UserId: userId, Emoji: emoji, CreatedAt: time.Now()})
+		// 唯一索引保证每人每种表情只计一次
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			respond(c, http.StatusInternalServerError, "server error", nil)
+			return
+		}
+		changed = err == nil
+	} else {
+		res, err := col.DeleteOne(c, bson.M{"messageId": m.ID, "userId": userId, "emoji": emoji})
+		if err != nil {
+			respond(c, http.StatusInternalServerError, "server error", nil)
+			return
+		}
+		changed = res.DeletedCount > 0
+	}
+	count, _ := col.CountDocuments(c, bson.M{"messageId": m.ID, "emoji": emoji})
+	if changed {
+		realtime.Default.Publish(realtime.ConversationTopic(m.ConversationId), realtime.Event{
+			Type:           realtime.EventReaction,
+			ConversationId: m.ConversationId,
+			Seq:            m.Seq,
+			Data:           gin.H{"message_id": m.ID.Hex(), "user_id": userId, "emoji": emoji, "added": add, "count": count},
+		})
+	}
+	respond(c, http.StatusOK, "success", gin.H{"emoji": emoji, "reacted": add, "count": count})
+}
+
+// attachReactions 批量汇总消息的表情回应数，并标记当前用户已回应的表情
+func attachReactions(ctx context.Context, list []model.Message, userId string) {
+	if len(list) == 0 {
+		return
+	}
+	ids := make([]primitive.ObjectID, 0, len(list))
+	for _, m := range list {
+		ids = append(ids, m.ID)
+	}
+	cur, err := repository.DB().Collection("message_reactions").Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"messageId": bson.M{"$in": ids}}},
+		{"$group": bson.M{
+			"_id":     bson.M{"messageId": "$messageId", "emoji": "$emoji"},
+			"count":   bson.M{"$sum": 1},
+			"reacted": bson.M{"$max": bson.M{"$eq": []interface{}{"$userId", userId}}},
+			"first":   bson.M{"$min": "$createdAt"},
+		}},
+		{"$sort": bson.M{"first": 1}},
+	})
+	if err != nil {
+		return
+	}
+	var rows []struct {
+		Key struct {
+			MessageId primitive.ObjectID `bson:"messageId"`
+			Emoji     string             `bson:"emoji"`
+		} `bson:"_id"`
+		Count   int  `bson:"count"`
+		Reacted bool `bson:"reacted"`
+	}
+	_ = cur.All(ctx, &rows)
+	byMsg := make(map[primitive.ObjectID][]model.ReactionCount)
+	for _, r := range rows {
+		byMsg[r.Key.MessageId] = append(byMsg[r.Key.MessageId], model.ReactionCount{Emoji: r.Key.Emoji, Count: r.Count, Reacted: r.Reacted})
+	}
+	for i := range list {
+		list[i].Reactions = byMsg[list[i].ID]
+	}
+}
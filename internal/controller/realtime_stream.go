@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"actiondelta/internal/model"
+	"actiondelta/internal/realtime"
+	"actiondelta/internal/repository"
+)
+
+const (
+	// gapWait 乱序到达时等待前序 seq 的最长时间；超时后以存储为准跳过空洞（如写入失败遗留的 seq）。
+	gapWait = 2 * time.Second
+	// replayBatch 断线续传时每批从存储补发的消息数。
+	replayBatch = 200
+	// accessRecheck 订阅期间定期复核访问权限，兜底未发布成员变更信号的场景。
+	accessRecheck = time.Minute
+)
+
+// errAccessRevoked 订阅期间失去会话访问权限。
+var errAccessRevoked = errors.New("access revoked")
+
+// convStream 将单个会话的消息按 seq 连续、不重复地投递给一个客户端。
+// 先订阅实时通道再从存储补发 lastSeq 之后的消息，乱序到达的消息暂存到前序补齐后再投递；
+// 非消息事件（如输入状态）直接透传。收到成员变更信号或定期复核时发现已无权访问，
+// 下发 access_revoked 并返回 errAccessRevoked。
+type convStream struct {
+	userId   string
+	convType string
+	convId   string
+	lastSeq  int64
+	pending  map[int64]model.Message
+	emit     func(realtime.Event) error
+}
+
+func newConvStream(userId, convType, convId string, lastSeq int64, emit func(realtime.Event) error) *convStream {
+	return &convStream{userId: userId, convType: convType, convId: convId, lastSeq: lastSeq, pending: make(map[int64]model.Message), emit: emit}
+}
+
+// run 阻塞投递直至 ctx 结束、emit 出错或失去访问权限。
+func (s *convStream) run(ctx context.Context) error {
+	topic := realtime.ConversationTopic(s.convId)
+	sub := realtime.Default.Subscribe(topic)
+	defer func() { sub.Close() }()
+	if err := s.replay(ctx); err != nil {
+		return err
+	}
+	recheck := time.NewTicker(accessRecheck)
+	defer recheck.Stop()
+	var gap <-chan time.Time
+	for {
+		if len(s.pending) == 0 {
+			gap = nil
+		} else if gap == nil {
+			gap = time.After(gapWait)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-sub.C:
+			if !ok {
+				// 消费过慢被 Hub 踢出：重新订阅并从存储补齐
+				sub = realtime.Default.Subscribe(topic)
+				if err := s.replay(ctx); err != nil {
+					return err
+				}
+				continue
+			}
+			if ev.Type == realtime.EventMembership {
+				if uid, _ := ev.Data.(string); uid == "" || uid == s.userId {
+					if err := s.checkAccess(ctx); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if ev.Type != realtime.EventMessage {
+				if err := s.emit(ev); err != nil {
+					return err
+				}
+				continue
+			}
+			if m, ok := ev.Data.(model.Message); ok {
+				s.accept(m)
+			}
+			if err := s.flush(false); err != nil {
+				return err
+			}
+		case <-recheck.C:
+			if err := s.checkAccess(ctx); err != nil {
+				return err
+			}
+		case <-gap:
+			gap = nil
+			if err := s.replay(ctx); err != nil {
+				return err
+			}
+			if err := s.flush(true); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// checkAccess 复核当前用户对会话的访问权限，失去权限时通知客户端。
+func (s *convStream) checkAccess(ctx context.Context) error {
+	if ok, msg := canAccessConversation(ctx, s.userId, s.convType, s.convId); !ok {
+		_ = s.emit(realtime.Event{Type: realtime.EventRevoked, ConversationId: s.convId, Data: gin.H{"message": msg}})
+		return errAccessRevoked
+	}
+	return nil
+}
+
+// publishMembership 通知会话的实时订阅复核访问权限；userId 为空时全部订阅者复核（如拉黑）。
+func publishMembership(convId, userId string) {
+	realtime.Default.Publish(realtime.ConversationTopic(convId), realtime.Event{Type: realtime.EventMembership, ConversationId: convId, Data: userId})
+}
+
+// replay 从存储读取 lastSeq 之后的消息并尽可能按序投递。
+func (s *convStream) replay(ctx context.Context) error {
+	from := s.lastSeq
+	for {
+		cur, err := repository.DB().Collection("messages").Find(ctx,
+			bson.M{"conversationId": s.convId, "seq": bson.M{"$gt": from}},
+			options.Find().SetSort(bson.M{"seq": 1}).SetLimit(replayBatch))
+		if err != nil {
+			return err
+		}
+		var batch []model.Message
+		if err := cur.All(ctx, &batch); err != nil {
+			return err
+		}
+		attachPreviews(ctx, batch)
+		for _, m := range batch {
+			s.accept(m)
+			from = m.Seq
+		}
+		if err := s.flush(false); err != nil {
+			return err
+		}
+		if len(batch) < replayBatch {
+			return nil
+		}
+	}
+}
+
+func (s *convStream) accept(m model.Message) {
+	if m.Seq > s.lastSeq {
+		s.pending[m.Seq] = m
+	}
+}
+
+// flush 投递从 lastSeq+1 开始连续的暂存消息；force 时跳过空洞投递全部暂存消息。
+func (s *convStream) flush(force bool) error {
+	for len(s.pending) > 0 {
+		m, ok := s.pending[s.lastSeq+1]
+		if !ok {
+			if !force {
+				return nil
+			}
+			next := int64(-1)
+			for seq := range s.pending {
+				if next < 0 || seq < next {
+					next = seq
+				}
+			}
+			s.lastSeq = next - 1
+			continue
+		}
+		delete(s.pending, m.Seq)
+		s.lastSeq = m.Seq
+		if err := s.emit(realtime.Event{Type: realtime.EventMessage, ConversationId: s.convId, Seq: m.Seq, Data: renderMessage(m, s.userId)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// currentSeq 会话当前已分配的最大 seq（无消息时为 0），用于“仅接收新消息”的订阅起点。
+func currentSeq(ctx context.Context, conversationId string) int64 {
+	var res struct {
+		Seq int64 `bson:"seq"`
+	}
+	if err := repository.DB().Collection("counters").FindOne(ctx, bson.M{"_id": conversationId}).Decode(&res); err != nil {
+		return 0
+	}
+	return res.Seq
+}
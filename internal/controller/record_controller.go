@@ -34,10 +34,18 @@ func CreateRecord(c *gin.Context) {
 	}
 	if len(msgOids) == 0 { respond(c, http.StatusBadRequest, "invalid message_ids", nil); return }
 	// 查询消息，推导参与者
-	cur, err := repository.DB().Collection("messages").Find(c, bson.M{"_id": bson.M{"$in": msgOids}})
+	// 已撤回/删除的消息不能收入戏文
+	cur, err := repository.DB().Collection("messages").Find(c, bson.M{"_id": bson.M{"$in": msgOids}, "deletedAt": nil, "recalled": bson.M{"$ne": true}})
 	if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
 	var msgs []model.Message
 	_ = cur.All(c, &msgs)
+	if len(msgs) == 0 { respond(c, http.StatusBadRequest, "invalid message_ids", nil); return }
+	// 戏文只收录皮上消息
+	for _, m := range msgs {
+		if m.MessageType != msgTypeCharacter { respond(c, http.StatusBadRequest, "only in-character messages can be recorded", nil); return }
+	}
+	msgOids = msgOids[:0]
+	for _, m := range msgs { msgOids = append(msgOids, m.ID) }
 	parts := make(map[string]model.CassetteParticipant)
 	for _, m := range msgs {
 		cp := model.CassetteParticipant{UserId: m.SenderUserId}
@@ -115,5 +123,6 @@ func GetRecordMessages(c *gin.Context) {
 	if err != nil { respond(c, http.StatusInternalServerError, "server error", nil); return }
 	var list []model.Message
 	_ = cur.All(c, &list)
-	respond(c, http.StatusOK, "success", gin.H{"messages": list})
+	attachPreviews(c, list)
+	respond(c, http.StatusOK, "success", gin.H{"messages": renderMessages(list, c.GetString("userId"))})
 } 
\ No newline at end of file
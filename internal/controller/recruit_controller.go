@@ -11,6 +11,7 @@ import (
 
 	"actiondelta/internal/model"
 	"actiondelta/internal/repository"
+	"actiondelta/internal/room"
 )
 
 // ListRecruits 招募列表（支持分页与基础筛选）
@@ -87,6 +88,26 @@ func CreateRecruit(c *gin.Context) {
 		respond(c, http.StatusBadRequest, "invalid backstory id", nil)
 		return
 	}
+	// 校验剧本与角色
+	b, err := loadBackstory(c, bid)
+	if err != nil || b.Status != backstoryApproved {
+		respond(c, http.StatusBadRequest, "backstory not found", nil)
+		return
+	}
+	if len(body.CustomCharacters) > 0 && body.Mode != modeDrama {
+		respond(c, http.StatusBadRequest, "customCharacters only allowed in drama mode", nil)
+		return
+	}
+	custom, rerr := normalizeCustomCharacters(b, body.CustomCharacters)
+	if rerr != nil {
+		respond(c, rerr.status, rerr.msg, nil)
+		return
+	}
+	roster := room.BuildRoster(b, body.Mode, custom)
+	if rerr := validateRecruitCharacters(body.Mode, roster, body.MyCharacters, body.TargetCharacters); rerr != nil {
+		respond(c, rerr.status, rerr.msg, nil)
+		return
+	}
 	now := time.Now()
 	rec := model.Recruit{
 		Title:            body.Title,
@@ -96,7 +117,7 @@ func CreateRecruit(c *gin.Context) {
 		MyCharacters:     body.MyCharacters,
 		TargetCharacters: body.TargetCharacters,
 		CustomContent:    body.CustomContent,
-		CustomCharacters: body.CustomCharacters,
+		CustomCharacters: custom,
 		Status:           "active",
 		CreatedAt:        now,
 		UpdatedAt:        now,
@@ -133,6 +154,7 @@ func AcceptRecruit(c *gin.Context) {
 	idHex := c.Param("id")
 	var body struct {
 		CharacterId string `json:"character_id"`
+		CostumeId   string `json:"costume_id"`
 	}
 	if err := c.ShouldBindJSON(&body); err != nil {
 		respond(c, http.StatusBadRequest, "invalid request", nil)
@@ -143,27 +165,12 @@ func AcceptRecruit(c *gin.Context) {
 		respond(c, http.StatusBadRequest, "invalid id", nil)
 		return
 	}
-	// 查找 theater，按 recruitId 复用/创建
-	var th model.Theater
-	err = repository.DB().Collection("theaters").FindOne(c, bson.M{"recruitId": oid}).Decode(&th)
+	res, err := rooms.Join(c, room.JoinRequest{RecruitId: oid, UserId: userId, CharacterId: body.CharacterId, CostumeId: body.CostumeId})
 	if err != nil {
-		th = model.Theater{RecruitId: oid, Title: "演绎房间", Mode: "couple", Status: "active", CreatedAt: time.Now(), UpdatedAt: time.Now()}
-		res, _ := repository.DB().Collection("theaters").InsertOne(c, th)
-		th.ID = res.InsertedID.(primitive.ObjectID)
-	}
-	// 加入参与者（去重）
-	exists := false
-	for _, p := range th.Participants {
-		if p.UserId == userId {
-			exists = true
-			break
-		}
-	}
-	if !exists {
-		th.Participants = append(th.Participants, model.TheaterParticipant{UserId: userId, CostumeId: body.CharacterId, JoinTime: time.Now()})
-		_, _ = repository.DB().Collection("theaters").UpdateByID(c, th.ID, bson.M{"$set": bson.M{"participants": th.Participants, "updatedAt": time.Now()}})
+		respondRoomError(c, err)
+		return
 	}
-	respond(c, http.StatusOK, "success", gin.H{"room_id": th.ID.Hex()})
+	respond(c, http.StatusOK, "success", gin.H{"room_id": res.Room.ID.Hex(), "participant": res.Participant})
 }
 
 func parseIntDefault(s string, def int) int {
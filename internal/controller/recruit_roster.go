@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"actiondelta/internal/model"
+	"actiondelta/internal/repository"
+	"actiondelta/internal/room"
+)
+
+// 演绎模式
+const (
+	modeCouple = room.ModeCouple
+	modeCrowd  = room.ModeCrowd
+	modeDrama  = room.ModeDrama
+)
+
+// rooms 入房、接取招募与邀请链接共用的房间服务
+var rooms = room.NewService(room.NewMongoStore())
+
+// roomError 入房/招募校验失败时携带的 HTTP 状态与提示
+type roomError struct {
+	status int
+	msg    string
+}
+
+func (e *roomError) Error() string { return e.msg }
+
+func badRequest(msg string) *roomError { return &roomError{status: http.StatusBadRequest, msg: msg} }
+func conflict(msg string) *roomError   { return &roomError{status: http.StatusConflict, msg: msg} }
+
+// respondRoomError 输出房间服务返回的错误：校验失败按其状态码返回提示，其余视为服务端错误
+func respondRoomError(c *gin.Context, err error) {
+	var e *room.Error
+	if errors.As(err, &e) {
+		respond(c, e.Status, e.Msg, nil)
+		return
+	}
+	respond(c, http.StatusInternalServerError, "server error", nil)
+}
+
+// loadBackstory 读取未删除的剧本
+func loadBackstory(c *gin.Context, id primitive.ObjectID) (model.Backstory, error) {
+	var b model.Backstory
+	err := repository.DB().Collection("backstories").FindOne(c, bson.M{"_id": id, "deletedAt": nil}).Decode(&b)
+	return b, err
+}
+
+// recruitRoster 解析招募关联剧本的角色表
+func recruitRoster(c *gin.Context, rec model.Recruit) (map[string]room.Character, error) {
+	b, err := loadBackstory(c, rec.BackstoryId)
+	if err != nil {
+		return nil, err
+	}
+	return room.BuildRoster(b, rec.Mode, rec.CustomCharacters), nil
+}
+
+// normalizeCustomCharacters 剧情模式自定义角色：名称必填，缺省 ID 自动生成且不得与剧本角色冲突
+func normalizeCustomCharacters(b model.Backstory, custom []model.CustomCharacter) ([]model.CustomCharacter, *roomError) {
+	taken := make(map[string]bool, len(b.Characters)+len(custom))
+	for _, ch := range b.Characters {
+		taken[ch.CharacterId] = true
+	}
+	out := make([]model.CustomCharacter, 0, len(custom))
+	for _, ch := range custom {
+		ch.Name = strings.TrimSpace(ch.Name)
+		if ch.Name == "" {
+			return nil, badRequest("custom character name required")
+		}
+		if ch.CharacterId == "" {
+			ch.CharacterId = "custom-" + uuid.NewString()
+		}
+		if taken[ch.CharacterId] {
+			return nil, badRequest("duplicate custom character_id: " + ch.CharacterId)
+		}
+		taken[ch.CharacterId] = true
+		out = append(out, ch)
+	}
+	return out, nil
+}
+
+// validateRecruitCharacters 校验我方/对方角色均属于角色表、互不重复，并符合模式人数规则：
+// 双人模式双方各一个角色；多人/剧情模式对方角色至少两个。
+func validateRecruitCharacters(mode string, roster map[string]room.Character, mine, targets []string) *roomError {
+	if len(mine) == 0 {
+		return badRequest("myCharacters required")
+	}
+	switch mode {
+	case modeCouple:
+		if len(mine) != 1 || len(targets) != 1 {
+			return badRequest("couple mode requires exactly one character on each side")
+		}
+	case modeCrowd, modeDrama:
+		if len(targets) < 2 {
+			return badRequest(mode + " mode requires at least two target characters")
+		}
+	default:
+		return badRequest("invalid mode")
+	}
+	seen := make(map[string]bool, len(mine)+len(targets))
+	for _, id := range append(append([]string{}, mine...), targets...) {
+		if _, ok := roster[id]; !ok {
+			return badRequest("unknown character: " + id)
+		}
+		if seen[id] {
+			return badRequest("duplicate character: " + id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// loadRecruit 读取未删除的招募
+func loadRecruit(c *gin.Context, id primitive.ObjectID) (model.Recruit, *roomError) {
+	var rec model.Recruit
+	if err := repository.DB().Collection("recruits").FindOne(c, bson.M{"_id": id, "deletedAt": nil}).Decode(&rec); err != nil {
+		return rec, &roomError{status: http.StatusNotFound, msg: "recruit not found"}
+	}
+	return rec, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -137,6 +137,8 @@ func DeleteFriend(c *gin.Context) {
 		respond(c, http.StatusInternalServerError, "server error", nil)
 		return
 	}
+	// 双方对彼此在线状态的订阅随即复核
+	publishFriendshipChange(a, b)
 	respond(c, http.StatusOK, "success", nil)
 }
 
@@ -164,6 +166,9 @@ func BlockUser(c *gin.Context) {
 	// 好友：无向边
 	a, b := orderPair(userId, other)
 	_, _ = repository.DB().Collection("friends").DeleteOne(c, bson.M{"userA": a, "userB": b})
+	// 双方的私聊实时订阅随即关闭，在线状态订阅随即复核
+	publishMembership(dmConversationId(a, b), "")
+	publishFriendshipChange(a, b)
 
 	respond(c, http.StatusOK, "success", nil)
 }
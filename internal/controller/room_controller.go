@@ -10,6 +10,7 @@ import (
 
 	"actiondelta/internal/model"
 	"actiondelta/internal/repository"
+	"actiondelta/internal/room"
 )
 
 // JoinRoom 根据 recruit_id 创建/加入演绎房间，并记录选择的角色。
@@ -18,6 +19,7 @@ func JoinRoom(c *gin.Context) {
 	var body struct {
 		RecruitId   string `json:"recruit_id"`
 		CharacterId string `json:"character_id"`
+		CostumeId   string `json:"costume_id"`
 	}
 	if err := c.ShouldBindJSON(&body); err != nil || body.RecruitId == "" {
 		respond(c, http.StatusBadRequest, "invalid request", nil)
@@ -28,25 +30,38 @@ func JoinRoom(c *gin.Context) {
 		respond(c, http.StatusBadRequest, "invalid id", nil)
 		return
 	}
-	var th model.Theater
-	err = repository.DB().Collection("theaters").FindOne(c, bson.M{"recruitId": rid}).Decode(&th)
+	res, err := rooms.Join(c, room.JoinRequest{RecruitId: rid, UserId: userId, CharacterId: body.CharacterId, CostumeId: body.CostumeId})
 	if err != nil {
-		th = model.Theater{RecruitId: rid, Title: "演绎房间", Mode: "couple", Status: "active", CreatedAt: time.Now(), UpdatedAt: time.Now()}
-		res, _ := repository.DB().Collection("theaters").InsertOne(c, th)
-		th.ID = res.InsertedID.(primitive.ObjectID)
+		respondRoomError(c, err)
+		return
 	}
-	exists := false
-	for _, p := range th.Participants {
-		if p.UserId == userId {
-			exists = true
-			break
-		}
+	respond(c, http.StatusOK, "success", gin.H{"room_id": res.Room.ID.Hex(), "participant": res.Participant})
+}
+
+// GetRoom 房间详情（仅参与者）：房间信息、房主、公告与置顶消息。
+func GetRoom(c *gin.Context) {
+	userId := c.GetString("userId")
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
 	}
-	if !exists {
-		th.Participants = append(th.Participants, model.TheaterParticipant{UserId: userId, CostumeId: body.CharacterId, JoinTime: time.Now()})
-		_, _ = repository.DB().Collection("theaters").UpdateByID(c, th.ID, bson.M{"$set": bson.M{"participants": th.Participants, "updatedAt": time.Now()}})
+	var th model.Theater
+	if err := repository.DB().Collection("theaters").FindOne(c, bson.M{"_id": oid}).Decode(&th); err != nil {
+		respond(c, http.StatusNotFound, "room not found", nil)
+		return
 	}
-	respond(c, http.StatusOK, "success", gin.H{"room_id": th.ID.Hex()})
+	if ok, msg := canAccessConversation(c, userId, "room", th.ID.Hex()); !ok {
+		respond(c, http.StatusForbidden, msg, nil)
+		return
+	}
+	if expireKickVotes(c, th) {
+		_ = repository.DB().Collection("theaters").FindOne(c, bson.M{"_id": oid}).Decode(&th)
+	}
+	th.HostId = roomHostId(c, th)
+	detail := conversationDetail(c, userId, "room", th.ID.Hex())
+	detail["room"] = th
+	respond(c, http.StatusOK, "success", detail)
 }
 
 // GetRoomMessages 复用统一消息历史接口，conversation_id 使用 room_id。
@@ -63,6 +78,9 @@ func SendRoomMessage(c *gin.Context) {
 		MessageType string                 `json:"message_type"`
 		Element     map[string]interface{} `json:"element"`
 		CharacterId string                 `json:"character_id"`
+		ReplyToId   string                 `json:"reply_to_id"`
+		QuoteId     string                 `json:"quote_id"`
+		MentionIds  []string               `json:"mention_user_ids"`
 	}
 	if err := c.ShouldBindJSON(&body); err != nil {
 		respond(c, http.StatusBadRequest, "invalid request", nil)
@@ -74,6 +92,85 @@ func SendRoomMessage(c *gin.Context) {
 		MessageType:      body.MessageType,
 		Element:          body.Element,
 		CharacterId:      body.CharacterId,
+		ReplyToId:        body.ReplyToId,
+		QuoteId:          body.QuoteId,
+		MentionUserIds:   body.MentionIds,
 	}
 	sendMessageInternal(c, req)
 }
+
+// SetRoomCostume 切换自己在房间中使用的用户皮（角色不可更改；costume_id 为空则恢复源角色形象；已结束/归档的房间不可切换）
+func SetRoomCostume(c *gin.Context) {
+	userId := c.GetString("userId")
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	var body struct {
+		CostumeId string `json:"costume_id"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respond(c, http.StatusBadRequest, "invalid request", nil)
+		return
+	}
+	var th model.Theater
+	if err := repository.DB().Collection("theaters").FindOne(c, bson.M{"_id": oid, "participants.userId": userId}).Decode(&th); err != nil {
+		respond(c, http.StatusForbidden, "not in room", nil)
+		return
+	}
+	if !room.Writable(th) {
+		respond(c, http.StatusForbidden, "room ended", nil)
+		return
+	}
+	rec, rerr := loadRecruit(c, th.RecruitId)
+	if rerr != nil {
+		respond(c, rerr.status, rerr.msg, nil)
+		return
+	}
+	roster, err := recruitRoster(c, rec)
+	if err != nil {
+		respond(c, http.StatusBadRequest, "backstory not found", nil)
+		return
+	}
+	var current model.TheaterParticipant
+	for _, p := range th.Participants {
+		if p.UserId == userId {
+			current = p
+			break
+		}
+	}
+	ch, ok := roster[room.CharacterOf(current)]
+	if !ok {
+		respond(c, http.StatusConflict, "character no longer in backstory", nil)
+		return
+	}
+	var cos *model.Costume
+	if body.CostumeId != "" {
+		if cos, rerr = loadOwnCostume(c, userId, body.CostumeId); rerr != nil {
+			respond(c, rerr.status, rerr.msg, nil)
+			return
+		}
+		if err := room.CheckCostume(cos, rec, ch.CharacterId); err != nil {
+			respondRoomError(c, err)
+			return
+		}
+	}
+	part := room.NewParticipant(userId, ch, cos)
+	_, err = repository.DB().Collection("theaters").UpdateOne(c,
+		bson.M{"_id": oid, "participants.userId": userId},
+		bson.M{"$set": bson.M{
+			"participants.$.characterId": part.CharacterId,
+			"participants.$.costumeId":   part.CostumeId,
+			"participants.$.costumeName": part.CostumeName,
+			"participants.$.avatar":      part.Avatar,
+			"updatedAt":                  time.Now(),
+		}})
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	part.JoinTime = current.JoinTime
+	part.MessageCount = current.MessageCount
+	respond(c, http.StatusOK, "success", gin.H{"participant": part})
+}
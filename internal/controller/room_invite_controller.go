@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"actiondelta/internal/auth"
+	"actiondelta/internal/model"
+	"actiondelta/internal/repository"
+	"actiondelta/internal/room"
+)
+
+// 邀请有效期（小时）
+const (
+	inviteDefaultHours = 24
+	inviteMaxHours     = 7 * 24
+)
+
+// CreateRoomInvite 生成邀请链接令牌 {expires_in_hours, max_uses}（进行中房间的参与者可用；max_uses 为 0 不限次数）
+func CreateRoomInvite(c *gin.Context) {
+	userId := c.GetString("userId")
+	var body struct {
+		ExpiresInHours int `json:"expires_in_hours"`
+		MaxUses        int `json:"max_uses"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.MaxUses < 0 || body.ExpiresInHours < 0 || body.ExpiresInHours > inviteMaxHours {
+		respond(c, http.StatusBadRequest, "invalid request", nil)
+		return
+	}
+	if body.ExpiresInHours == 0 {
+		body.ExpiresInHours = inviteDefaultHours
+	}
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	var th model.Theater
+	if err := repository.DB().Collection("theaters").FindOne(c, bson.M{"_id": oid, "participants.userId": userId}).Decode(&th); err != nil {
+		respond(c, http.StatusForbidden, "not in room", nil)
+		return
+	}
+	if !room.Writable(th) {
+		respond(c, http.StatusForbidden, "room ended", nil)
+		return
+	}
+	now := time.Now()
+	inv := model.RoomInvite{
+		RoomId:      th.ID,
+		CreatedBy:   userId,
+		MaxUses:     body.MaxUses,
+		ExpiresAt:   now.Add(time.Duration(body.ExpiresInHours) * time.Hour),
+		Redemptions: []model.InviteRedemption{},
+		CreatedAt:   now,
+	}
+	res, err := repository.DB().Collection("room_invites").InsertOne(c, inv)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	inv.ID = res.InsertedID.(primitive.ObjectID)
+	token, err := auth.GenerateInviteToken(inv.ID.Hex(), th.ID.Hex(), inv.ExpiresAt)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	respond(c, http.StatusOK, "success", gin.H{"invite": inv, "token": token})
+}
+
+// RedeemRoomInvite 通过邀请令牌入房 {token, character_id, costume_id}，角色与用户皮规则同 room/join。
+// 已在房间中的用户直接返回，不占用次数。
+func RedeemRoomInvite(c *gin.Context) {
+	userId := c.GetString("userId")
+	var body struct {
+		Token       string `json:"token"`
+		CharacterId string `json:"character_id"`
+		CostumeId   string `json:"costume_id"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Token == "" {
+		respond(c, http.StatusBadRequest, "invalid request", nil)
+		return
+	}
+	claims, err := auth.ParseInviteToken(body.Token)
+	if err != nil {
+		respond(c, http.StatusGone, "invite invalid or expired", nil)
+		return
+	}
+	inviteId, err := primitive.ObjectIDFromHex(claims.ID)
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid invite", nil)
+		return
+	}
+	col := repository.DB().Collection("room_invites")
+	var inv model.RoomInvite
+	if err := col.FindOne(c, bson.M{"_id": inviteId}).Decode(&inv); err != nil || inv.RoomId.Hex() != claims.RoomId {
+		respond(c, http.StatusNotFound, "invite not found", nil)
+		return
+	}
+	if inv.RevokedAt != nil {
+		respond(c, http.StatusGone, "invite revoked", nil)
+		return
+	}
+	var th model.Theater
+	if err := repository.DB().Collection("theaters").FindOne(c, bson.M{"_id": inv.RoomId}).Decode(&th); err != nil {
+		respond(c, http.StatusNotFound, "room not found", nil)
+		return
+	}
+	for _, p := range th.Participants {
+		if p.UserId == userId {
+			respond(c, http.StatusOK, "success", gin.H{"room_id": th.ID.Hex(), "participant": p})
+			return
+		}
+	}
+	// 先占用一次使用次数（条件更新保证并发下不超过 max_uses），入房失败再退回
+	now := time.Now()
+	res, err := col.UpdateOne(c, bson.M{
+		"_id":       inv.ID,
+		"revokedAt": nil,
+		"expiresAt": bson.M{"$gt": now},
+		"$or":       []bson.M{{"maxUses": 0}, {"$expr": bson.M{"$lt": bson.A{"$uses", "$maxUses"}}}},
+	}, bson.M{"$inc": bson.M{"uses": 1}})
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	if res.ModifiedCount == 0 {
+		respond(c, http.StatusGone, "invite expired or used up", nil)
+		return
+	}
+	join, err := rooms.Join(c, room.JoinRequest{RecruitId: th.RecruitId, UserId: userId, CharacterId: body.CharacterId, CostumeId: body.CostumeId})
+	if err != nil || !join.Joined {
+		_, _ = col.UpdateByID(c, inv.ID, bson.M{"$inc": bson.M{"uses": -1}})
+	}
+	if err != nil {
+		respondRoomError(c, err)
+		return
+	}
+	if join.Joined {
+		_, _ = col.UpdateByID(c, inv.ID, bson.M{"$push": bson.M{"redemptions": model.InviteRedemption{
+			UserId:      userId,
+			CharacterId: join.Participant.CharacterId,
+			JoinedAt:    now,
+		}}})
+	}
+	respond(c, http.StatusOK, "success", gin.H{"room_id": join.Room.ID.Hex(), "participant": join.Participant})
+}
+
+// ListRoomInvites 房主查看房间的邀请及通过各邀请加入的用户
+func ListRoomInvites(c *gin.Context) {
+	th, ok := loadHostedRoom(c, c.GetString("userId"))
+	if !ok {
+		return
+	}
+	cur, err := repository.DB().Collection("room_invites").Find(c, bson.M{"roomId": th.ID}, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	list := []model.RoomInvite{}
+	_ = cur.All(c, &list)
+	respond(c, http.StatusOK, "success", gin.H{"list": list})
+}
+
+// RevokeRoomInvite 房主撤销邀请，已签发的令牌随即失效
+func RevokeRoomInvite(c *gin.Context) {
+	th, ok := loadHostedRoom(c, c.GetString("userId"))
+	if !ok {
+		return
+	}
+	inviteId, err := primitive.ObjectIDFromHex(c.Param("invite_id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid invite id", nil)
+		return
+	}
+	res, err := repository.DB().Collection("room_invites").UpdateOne(c,
+		bson.M{"_id": inviteId, "roomId": th.ID, "revokedAt": nil},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	if res.MatchedCount == 0 {
+		respond(c, http.StatusNotFound, "invite not found or already revoked", nil)
+		return
+	}
+	respond(c, http.StatusOK, "success", nil)
+}
@@ -0,0 +1,276 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"actiondelta/internal/model"
+	"actiondelta/internal/repository"
+	"actiondelta/internal/room"
+)
+
+// kickVoteTTL 踢人投票有效期，过期后在下次访问房间时关闭
+const kickVoteTTL = 10 * time.Minute
+
+// 投票状态
+const (
+	kickOpen      = "open"
+	kickPassed    = "passed"
+	kickRejected  = "rejected"
+	kickExpired   = "expired"
+	kickCancelled = "cancelled" // 被投票人已离开房间
+)
+
+// StartKick 发起踢人 {user_id}：双人模式直接移出对方；多人/剧情模式发起投票（发起人默认赞成），
+// 超过半数其他参与者同意即移出。被移出的用户不得再加入该房间。
+func StartKick(c *gin.Context) {
+	userId := c.GetString("userId")
+	var body struct {
+		UserId string `json:"user_id"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.UserId == "" {
+		respond(c, http.StatusBadRequest, "invalid request", nil)
+		return
+	}
+	if body.UserId == userId {
+		respond(c, http.StatusBadRequest, "cannot kick yourself", nil)
+		return
+	}
+	th, ok := loadKickRoom(c, userId)
+	if !ok {
+		return
+	}
+	if !isParticipant(th, body.UserId) {
+		respond(c, http.StatusBadRequest, "user not in room", nil)
+		return
+	}
+	if th.Mode == modeCouple {
+		kicked, host := kickParticipant(c, th, body.UserId)
+		if !kicked {
+			respond(c, http.StatusConflict, "user not in room", nil)
+			return
+		}
+		postSystemMessage(c, "room", th.ID.Hex(), userId, "kick",
+			withNewHost(c, nickname(c, userId)+" 将 "+nickname(c, body.UserId)+" 移出了房间", host), body.UserId)
+		respond(c, http.StatusOK, "success", gin.H{"kicked": true})
+		return
+	}
+	now := time.Now()
+	vote := model.KickVote{
+		ID:           primitive.NewObjectID(),
+		TargetUserId: body.UserId,
+		InitiatorId:  userId,
+		Approvals:    []string{userId},
+		Rejections:   []string{},
+		Status:       kickOpen,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(kickVoteTTL),
+	}
+	res, err := repository.DB().Collection("theaters").UpdateOne(c, bson.M{
+		"_id":                 th.ID,
+		"participants.userId": bson.M{"$all": []string{userId, body.UserId}},
+		"kickVotes":           bson.M{"$not": bson.M{"$elemMatch": bson.M{"targetUserId": body.UserId, "status": kickOpen}}},
+	}, bson.M{"$push": bson.M{"kickVotes": vote}})
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	if res.MatchedCount == 0 {
+		respond(c, http.StatusConflict, "vote already in progress", nil)
+		return
+	}
+	postSystemMessage(c, "room", th.ID.Hex(), userId, "kick_vote",
+		nickname(c, userId)+" 发起了将 "+nickname(c, body.UserId)+" 移出房间的投票", body.UserId)
+	vote = tallyKickVote(c, th.ID, vote.ID, userId)
+	respond(c, http.StatusOK, "success", gin.H{"vote": vote, "kicked": vote.Status == kickPassed})
+}
+
+// CastKickVote 投票 {approve}；可改票，被投票人不能投票
+func CastKickVote(c *gin.Context) {
+	userId := c.GetString("userId")
+	vid, err := primitive.ObjectIDFromHex(c.Param("vote_id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid vote id", nil)
+		return
+	}
+	var body struct {
+		Approve *bool `json:"approve"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Approve == nil {
+		respond(c, http.StatusBadRequest, "invalid request", nil)
+		return
+	}
+	th, ok := loadKickRoom(c, userId)
+	if !ok {
+		return
+	}
+	add, remove := "kickVotes.$.approvals", "kickVotes.$.rejections"
+	if !*body.Approve {
+		add, remove = remove, add
+	}
+	res, err := repository.DB().Collection("theaters").UpdateOne(c, bson.M{
+		"_id":                 th.ID,
+		"participants.userId": userId,
+		"kickVotes": bson.M{"$elemMatch": bson.M{
+			"id":           vid,
+			"status":       kickOpen,
+			"expiresAt":    bson.M{"$gt": time.Now()},
+			"targetUserId": bson.M{"$ne": userId},
+		}},
+	}, bson.M{"$addToSet": bson.M{add: userId}, "$pull": bson.M{remove: userId}})
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	if res.MatchedCount == 0 {
+		respond(c, http.StatusConflict, "vote closed or not allowed", nil)
+		return
+	}
+	vote := tallyKickVote(c, th.ID, vid, userId)
+	respond(c, http.StatusOK, "success", gin.H{"vote": vote, "kicked": vote.Status == kickPassed})
+}
+
+// loadKickRoom 读取路径参数中的房间（当前用户须为参与者且房间进行中），并关闭已过期的投票
+func loadKickRoom(c *gin.Context, userId string) (model.Theater, bool) {
+	var th model.Theater
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return th, false
+	}
+	if err := repository.DB().Collection("theaters").FindOne(c, bson.M{"_id": oid, "participants.userId": userId}).Decode(&th); err != nil {
+		respond(c, http.StatusForbidden, "not in room", nil)
+		return th, false
+	}
+	if !room.Writable(th) {
+		respond(c, http.StatusForbidden, "room ended", nil)
+		return th, false
+	}
+	expireKickVotes(c, th)
+	return th, true
+}
+
+// tallyKickVote 计票：赞成超过其他参与者半数即通过并移出，反对达到半数即否决（已无法通过）
+func tallyKickVote(c *gin.Context, roomId, voteId primitive.ObjectID, operatorId string) model.KickVote {
+	var th model.Theater
+	if err := repository.DB().Collection("theaters").FindOne(c, bson.M{"_id": roomId}).Decode(&th); err != nil {
+		return model.KickVote{}
+	}
+	vote, ok := findKickVote(th, voteId)
+	if !ok || vote.Status != kickOpen {
+		return vote
+	}
+	if !isParticipant(th, vote.TargetUserId) {
+		closeKickVote(c, roomId, voteId, kickCancelled)
+		vote.Status = kickCancelled
+		return vote
+	}
+	voters := make(map[string]bool, len(th.Participants))
+	for _, p := range th.Participants {
+		if p.UserId != vote.TargetUserId {
+			voters[p.UserId] = true
+		}
+	}
+	approvals, rejections := 0, 0
+	for _, u := range vote.Approvals {
+		if voters[u] {
+			approvals++
+		}
+	}
+	for _, u := range vote.Rejections {
+		if voters[u] {
+			rejections++
+		}
+	}
+	target := nickname(c, vote.TargetUserId)
+	switch {
+	case approvals*2 > len(voters):
+		if closeKickVote(c, roomId, voteId, kickPassed) {
+			vote.Status = kickPassed
+			_, host := kickParticipant(c, th, vote.TargetUserId)
+			postSystemMessage(c, "room", roomId.Hex(), operatorId, "kick_result", withNewHost(c, "投票通过，"+target+" 被移出房间", host), vote.TargetUserId)
+		}
+	case rejections*2 >= len(voters):
+		if closeKickVote(c, roomId, voteId, kickRejected) {
+			vote.Status = kickRejected
+			postSystemMessage(c, "room", roomId.Hex(), operatorId, "kick_result", "将 "+target+" 移出房间的投票未通过", vote.TargetUserId)
+		}
+	}
+	return vote
+}
+
+// expireKickVotes 关闭已过期的投票并公告结果，返回是否有投票被关闭
+func expireKickVotes(c *gin.Context, th model.Theater) bool {
+	now := time.Now()
+	closed := false
+	for _, v := range th.KickVotes {
+		if v.Status != kickOpen || v.ExpiresAt.After(now) {
+			continue
+		}
+		if closeKickVote(c, th.ID, v.ID, kickExpired) {
+			closed = true
+			postSystemMessage(c, "room", th.ID.Hex(), v.InitiatorId, "kick_result",
+				"将 "+nickname(c, v.TargetUserId)+" 移出房间的投票已过期", v.TargetUserId)
+		}
+	}
+	return closed
+}
+
+// closeKickVote 将进行中的投票置为最终状态；仅首次关闭返回 true，保证结果只公告一次
+func closeKickVote(c *gin.Context, roomId, voteId primitive.ObjectID, status string) bool {
+	now := time.Now()
+	res, err := repository.DB().Collection("theaters").UpdateOne(c,
+		bson.M{"_id": roomId, "kickVotes": bson.M{"$elemMatch": bson.M{"id": voteId, "status": kickOpen}}},
+		bson.M{"$set": bson.M{"kickVotes.$.status": status, "kickVotes.$.closedAt": now}})
+	return err == nil && res.ModifiedCount > 0
+}
+
+// kickParticipant 移出参与者、记入封禁名单并关闭其房间实时订阅，返回是否移出成功及（被移出者为房主时）接任的新房主
+func kickParticipant(c *gin.Context, th model.Theater, target string) (bool, string) {
+	var after model.Theater
+	err := repository.DB().Collection("theaters").FindOneAndUpdate(c,
+		bson.M{"_id": th.ID, "participants.userId": target},
+		bson.M{
+			"$pull":     bson.M{"participants": bson.M{"userId": target}},
+			"$addToSet": bson.M{"bannedUserIds": target},
+			"$set":      bson.M{"updatedAt": time.Now()},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&after)
+	if err != nil {
+		return false, ""
+	}
+	// 被移出者已打开的实时订阅随即关闭
+	publishMembership(th.ID.Hex(), target)
+	return true, handOverHost(c, after, target)
+}
+
+// withNewHost 系统消息中追加房主变更
+func withNewHost(c *gin.Context, text, host string) string {
+	if host == "" {
+		return text
+	}
+	return text + "，" + nickname(c, host) + " 成为房主"
+}
+
+func findKickVote(th model.Theater, id primitive.ObjectID) (model.KickVote, bool) {
+	for _, v := range th.KickVotes {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return model.KickVote{}, false
+}
+
+func isParticipant(th model.Theater, userId string) bool {
+	for _, p := range th.Participants {
+		if p.UserId == userId {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"actiondelta/internal/config"
+	"actiondelta/internal/model"
+	"actiondelta/internal/repository"
+	"actiondelta/internal/room"
+)
+
+// 房间状态
+const (
+	roomActive   = room.StatusActive
+	roomEnded    = room.StatusEnded
+	roomArchived = room.StatusArchived
+)
+
+// roomArchiveInterval 自动归档的检查间隔
+const roomArchiveInterval = time.Hour
+
+// LeaveRoom 退出房间；房主退出时由最早加入的参与者接任，最后一人退出后演绎结束。
+func LeaveRoom(c *gin.Context) {
+	userId := c.GetString("userId")
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	var th model.Theater
+	err = repository.DB().Collection("theaters").FindOneAndUpdate(c,
+		bson.M{"_id": oid, "participants.userId": userId},
+		bson.M{"$pull": bson.M{"participants": bson.M{"userId": userId}}, "$set": bson.M{"updatedAt": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&th)
+	if err != nil {
+		respond(c, http.StatusForbidden, "not in room", nil)
+		return
+	}
+	publishMembership(th.ID.Hex(), userId)
+	text := nickname(c, userId) + " 离开了房间"
+	if len(th.Participants) == 0 {
+		if endRoom(c, th, roomEnded) {
+			text += "，演绎已结束"
+		}
+	} else {
+		text = withNewHost(c, text, handOverHost(c, th, userId))
+	}
+	postSystemMessage(c, "room", th.ID.Hex(), userId, "leave", text, userId)
+	respond(c, http.StatusOK, "success", nil)
+}
+
+// handOverHost 房主离开房间（th 为移除后的房间）时由最早加入的参与者接任，返回新房主；离开者不是房主时返回空
+func handOverHost(c *gin.Context, th model.Theater, leaving string) string {
+	if len(th.Participants) == 0 || roomHostId(c, th) != leaving {
+		return ""
+	}
+	next := th.Participants[0]
+	for _, p := range th.Participants[1:] {
+		if p.JoinTime.Before(next.JoinTime) {
+			next = p
+		}
+	}
+	_, _ = repository.DB().Collection("theaters").UpdateOne(c, bson.M{"_id": th.ID, "participants.userId": next.UserId},
+		bson.M{"$set": bson.M{"hostId": next.UserId}})
+	return next.UserId
+}
+
+// EndRoom 房主结束演绎，房间转为只读并将招募标记为完成/取消
+func EndRoom(c *gin.Context) {
+	userId := c.GetString("userId")
+	th, ok := loadHostedRoom(c, userId)
+	if !ok {
+		return
+	}
+	if !endRoom(c, th, roomEnded) {
+		respond(c, http.StatusConflict, "room not active", nil)
+		return
+	}
+	postSystemMessage(c, "room", th.ID.Hex(), userId, "end", nickname(c, userId)+" 结束了演绎", "")
+	respond(c, http.StatusOK, "success", nil)
+}
+
+// ReopenRoom 房主重新开启已结束/归档的房间，招募恢复为进行中
+func ReopenRoom(c *gin.Context) {
+	userId := c.GetString("userId")
+	th, ok := loadHostedRoom(c, userId)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	res, err := repository.DB().Collection("theaters").UpdateOne(c,
+		bson.M{"_id": th.ID, "status": bson.M{"$in": []string{roomEnded, roomArchived}}},
+		bson.M{"$set": bson.M{"status": roomActive, "updatedAt": now}, "$unset": bson.M{"endedAt": ""}})
+	if err != nil {
+		respond(c, http.StatusInternalServerError, "server error", nil)
+		return
+	}
+	if res.ModifiedCount == 0 {
+		respond(c, http.StatusConflict, "room already active", nil)
+		return
+	}
+	_, _ = repository.DB().Collection("recruits").UpdateOne(c,
+		bson.M{"_id": th.RecruitId, "deletedAt": nil, "status": bson.M{"$in": []string{"completed", "cancelled"}}},
+		bson.M{"$set": bson.M{"status": "active", "updatedAt": now}})
+	postSystemMessage(c, "room", th.ID.Hex(), userId, "reopen", nickname(c, userId)+" 重新开启了演绎", "")
+	respond(c, http.StatusOK, "success", nil)
+}
+
+// loadHostedRoom 读取路径参数中的房间并校验当前用户为房主
+func loadHostedRoom(c *gin.Context, userId string) (model.Theater, bool) {
+	var th model.Theater
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond(c, http.StatusBadRequest, "invalid id", nil)
+		return th, false
+	}
+	if err := repository.DB().Collection("theaters").FindOne(c, bson.M{"_id": oid, "participants.userId": userId}).Decode(&th); err != nil {
+		respond(c, http.StatusForbidden, "not in room", nil)
+		return th, false
+	}
+	if roomHostId(c, th) != userId {
+		respond(c, http.StatusForbidden, "only host can do this", nil)
+		return th, false
+	}
+	return th, true
+}
+
+// endRoom 将进行中的房间置为结束/归档（条件更新，重复调用无副作用），成功时同步招募状态
+func endRoom(ctx context.Context, th model.Theater, status string) bool {
+	now := time.Now()
+	res, err := repository.DB().Collection("theaters").UpdateOne(ctx,
+		bson.M{"_id": th.ID, "status": bson.M{"$in": []interface{}{roomActive, "", nil}}},
+		bson.M{"$set": bson.M{"status": status, "endedAt": now, "updatedAt": now}})
+	if err != nil || res.ModifiedCount == 0 {
+		return false
+	}
+	finishRecruit(ctx, th)
+	return true
+}
+
+// finishRecruit 房间结束后同步招募：有过皮上消息视为完成，否则视为取消
+func finishRecruit(ctx context.Context, th model.Theater) {
+	status := "cancelled"
+	cnt, _ := repository.DB().Collection("messages").CountDocuments(ctx,
+		bson.M{"conversationId": th.ID.Hex(), "messageType": msgTypeCharacter, "deletedAt": nil},
+		options.Count().SetLimit(1))
+	if cnt > 0 {
+		status = "completed"
+	}
+	_, _ = repository.DB().Collection("recruits").UpdateOne(ctx,
+		bson.M{"_id": th.RecruitId, "status": "active"},
+		bson.M{"$set": bson.M{"status": status, "updatedAt": time.Now()}})
+}
+
+// StartRoomArchiver 定期归档长时间无新消息的房间（room.archive_after_hours 为 0 时不启动），随 ctx 取消退出。
+func StartRoomArchiver(ctx context.Context) {
+	idle := config.RoomArchiveAfter()
+	if idle <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(roomArchiveInterval)
+		defer ticker.Stop()
+		for {
+			if n, err := archiveIdleRooms(ctx, time.Now().Add(-idle)); err != nil {
+				zap.L().Warn("archive idle rooms failed", zap.Error(err))
+			} else if n > 0 {
+				zap.L().Info("archived idle rooms", zap.Int("count", n))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// archiveIdleRooms 归档 cutoff 之后既无房间变更也无新消息的进行中房间
+func archiveIdleRooms(ctx context.Context, cutoff time.Time) (int, error) {
+	cur, err := repository.DB().Collection("theaters").Find(ctx,
+		bson.M{"status": bson.M{"$in": []interface{}{roomActive, "", nil}}, "updatedAt": bson.M{"$lt": cutoff}},
+		options.Find().SetProjection(bson.M{"_id": 1, "recruitId": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var rooms []model.Theater
+	if err := cur.All(ctx, &rooms); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, th := range rooms {
+		var conv model.Conversation
+		err := repository.DB().Collection("conversations").FindOne(ctx, bson.M{"conversationId": th.ID.Hex()}).Decode(&conv)
+		if err == nil && conv.UpdatedAt.After(cutoff) {
+			continue
+		}
+		if endRoom(ctx, th, roomArchived) {
+			n++
+		}
+	}
+	return n, nil
+}
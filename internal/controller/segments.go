@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"actiondelta/internal/model"
+	"actiondelta/internal/repository"
+)
+
+// 文本片段类型
+const (
+	segmentSpeech = "speech" // 对白
+	segmentAction = "action" // 【】内的动作、心理描写
+)
+
+// parseSegments 将消息文本按【】拆分为对白与动作片段；未闭合的【按普通文字处理。
+func parseSegments(text string) []model.MessageSegment {
+	var segs []model.MessageSegment
+	add := func(typ, s string) {
+		if strings.TrimSpace(s) == "" {
+			return
+		}
+		// 相邻同类片段合并（如未闭合的【被并回对白）
+		if n := len(segs); n > 0 && segs[n-1].Type == typ {
+			segs[n-1].Text += s
+			return
+		}
+		segs = append(segs, model.MessageSegment{Type: typ, Text: s})
+	}
+	rest := text
+	for rest != "" {
+		open := strings.Index(rest, "【")
+		if open < 0 {
+			break
+		}
+		closing := strings.Index(rest[open:], "】")
+		if closing < 0 {
+			break
+		}
+		add(segmentSpeech, rest[:open])
+		add(segmentAction, rest[open+len("【"):open+closing])
+		rest = rest[open+closing+len("】"):]
+	}
+	add(segmentSpeech, rest)
+	return segs
+}
+
+// elementSegments 解析元素中的 data.text；非文本元素返回 nil
+func elementSegments(e model.MessageElement) []model.MessageSegment {
+	text, _ := e.Data["text"].(string)
+	if text == "" {
+		return nil
+	}
+	return parseSegments(text)
+}
+
+// countWords 统计字数：不计空白与标点，中文按字、其他按字符计
+func countWords(s string) int {
+	n := 0
+	for _, r := range s {
+		if !unicode.IsSpace(r) && !unicode.IsPunct(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// segmentWords 各类片段字数
+func segmentWords(segs []model.MessageSegment) (speech, action int) {
+	for _, s := range segs {
+		if s.Type == segmentAction {
+			action += countWords(s.Text)
+		} else {
+			speech += countWords(s.Text)
+		}
+	}
+	return
+}
+
+// addWordCount 累加皮上消息字数到用户总字数与分类统计（sign 为 -1 时扣减，用于撤回/删除）
+func addWordCount(c *gin.Context, m model.Message, sign int) {
+	if m.MessageType != msgTypeCharacter {
+		return
+	}
+	speech, action := segmentWords(m.Element.Segments)
+	if speech+action == 0 {
+		return
+	}
+	_, _ = repository.DB().Collection("users").UpdateOne(c, bson.M{"userId": m.SenderUserId},
+		bson.M{"$inc": bson.M{"wordCount": sign * (speech + action)}})
+	_, _ = repository.DB().Collection("user_stats").UpdateOne(c, bson.M{"userId": m.SenderUserId},
+		bson.M{"$inc": bson.M{"speechWords": sign * speech, "actionWords": sign * action}},
+		options.Update().SetUpsert(true))
+}
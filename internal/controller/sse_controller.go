@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"actiondelta/internal/realtime"
+)
+
+// sseHeartbeat 注释行心跳间隔，防止代理因空闲断开长连接。
+const sseHeartbeat = 25 * time.Second
+
+// StreamMessages 会话消息的 SSE 推送（WebSocket 不可用时的降级通道）。
+// 续传起点优先取 Last-Event-ID 请求头（即上次收到的 seq），其次 last_seq 参数，都缺省时只推送新消息。
+// 访问权限在推送期间由 convStream 持续复核，失去权限时推送 access_revoked 并结束响应。
+func StreamMessages(c *gin.Context) {
+	userId := c.GetString("userId")
+	convType := c.Query("conversation_type")
+	convId := c.Query("conversation_id")
+	if convId == "" {
+		respond(c, http.StatusBadRequest, "missing conversation_id", nil)
+		return
+	}
+	if ok, msg := canAccessConversation(c, userId, convType, convId); !ok {
+		respond(c, http.StatusForbidden, msg, nil)
+		return
+	}
+	ctx := c.Request.Context()
+	start := currentSeq(ctx, convId)
+	resume := c.GetHeader("Last-Event-ID")
+	if resume == "" {
+		resume = c.Query("last_seq")
+	}
+	if resume != "" {
+		seq, err := strconv.ParseInt(resume, 10, 64)
+		if err != nil || seq < 0 {
+			respond(c, http.StatusBadRequest, "invalid last event id", nil)
+			return
+		}
+		start = seq
+	}
+
+	// 长连接不受服务器 WriteTimeout 限制
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	openPresence(ctx, userId)
+	defer closePresence(userId)
+
+	var mu sync.Mutex
+	write := func(chunk string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := c.Writer.WriteString(chunk); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+	// 客户端断线后按 retry 毫秒重连，并由浏览器自动携带 Last-Event-ID
+	if err := write("retry: 3000\n\n"); err != nil {
+		return
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- newConvStream(userId, convType, convId, start, func(ev realtime.Event) error {
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return err
+			}
+			// 仅消息事件携带 id，非消息事件不影响续传位置
+			if ev.Type == realtime.EventMessage {
+				return write(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Type, data))
+			}
+			return write(fmt.Sprintf("event: %s\ndata: %s\n\n", ev.Type, data))
+		}).run(ctx)
+	}()
+
+	ticker := time.NewTicker(sseHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := write(": ping\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
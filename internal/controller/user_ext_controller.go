@@ -42,9 +42,6 @@ func GetUserProfile(c *gin.Context) {
         isFollowing = cnt > 0
     }
 
-    // 在线状态：5分钟内心跳视为在线
-    online := time.Since(u.LastSeenAt) <= 5*time.Minute
-
     respond(c, http.StatusOK, "success", gin.H{
         "profile": gin.H{
             "user_id":         u.UserId,
@@ -52,10 +49,13 @@ func GetUserProfile(c *gin.Context) {
             "avatar":          u.Avatar,
             "bio":             u.Bio,
             "gender":          u.Gender,
-            "online":          online,
+            "online":          u.Online, // 以实时连接为准，见 openPresence/closePresence
             "last_seen_at":    u.LastSeenAt,
             "followers_count": stats.FollowersCount,
             "following_count": stats.FollowingCount,
+            "word_count":      u.WordCount,
+            "speech_words":    stats.SpeechWords,
+            "action_words":    stats.ActionWords,
             "created_at":      u.CreatedAt,
             "updated_at":      u.UpdatedAt,
         },
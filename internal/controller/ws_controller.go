@@ -0,0 +1,285 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"actiondelta/internal/realtime"
+)
+
+const (
+	wsWriteWait        = 10 * time.Second
+	wsPongWait         = 60 * time.Second
+	wsPingPeriod       = 50 * time.Second
+	wsMaxFrameBytes    = 4096
+	wsMaxSubscriptions = 50
+	wsTypingInterval   = time.Second
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	// App/小程序客户端不带浏览器 Origin，鉴权依赖令牌
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsCommand 客户端上行指令。
+// last_seq 缺省时仅接收订阅之后的新消息；传入时从该 seq 之后补发（断线续传）。
+type wsCommand struct {
+	Action           string   `json:"action"` // subscribe|unsubscribe|typing|subscribe_presence|unsubscribe_presence|ping
+	ConversationType string   `json:"conversation_type"`
+	ConversationId   string   `json:"conversation_id"`
+	LastSeq          *int64   `json:"last_seq"`
+	Typing           *bool    `json:"typing"` // typing 指令：缺省视为 true，false 表示停止输入
+	UserIds          []string `json:"user_ids"`
+}
+
+// wsSub 单个会话订阅；投递协程因失去访问权限退出时 ctx 被取消，读循环据此视为未订阅。
+type wsSub struct {
+	ctx  context.Context
+	stop context.CancelFunc
+}
+
+// wsSession 单条 WebSocket 连接；写操作串行化，订阅表仅由读循环维护。
+type wsSession struct {
+	conn       *websocket.Conn
+	userId     string
+	mu         sync.Mutex
+	subs       map[string]wsSub
+	presence   map[string]wsSub
+	lastTyping map[string]time.Time
+}
+
+func (s *wsSession) send(ev realtime.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return s.conn.WriteJSON(ev)
+}
+
+func (s *wsSession) sendError(convId, msg string) {
+	_ = s.send(realtime.Event{Type: realtime.EventError, ConversationId: convId, Data: gin.H{"message": msg}})
+}
+
+// RealtimeWS 实时消息通道：鉴权后升级为 WebSocket，客户端按会话订阅并接收新消息。
+func RealtimeWS(c *gin.Context) {
+	userId := c.GetString("userId")
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return // Upgrade 已写回错误响应
+	}
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	defer conn.Close()
+
+	s := &wsSession{
+		conn:       conn,
+		userId:     userId,
+		subs:       make(map[string]wsSub),
+		presence:   make(map[string]wsSub),
+		lastTyping: make(map[string]time.Time),
+	}
+	openPresence(ctx, userId)
+	defer closePresence(userId)
+	conn.SetReadLimit(wsMaxFrameBytes)
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error { return conn.SetReadDeadline(time.Now().Add(wsPongWait)) })
+	go s.pingLoop(ctx)
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var cmd wsCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			s.sendError("", "invalid command")
+			continue
+		}
+		switch cmd.Action {
+		case "subscribe":
+			s.subscribe(c, ctx, cmd)
+		case "unsubscribe":
+			if sub, ok := s.subs[cmd.ConversationId]; ok {
+				sub.stop()
+				delete(s.subs, cmd.ConversationId)
+			}
+			_ = s.send(realtime.Event{Type: realtime.EventUnsubscribed, ConversationId: cmd.ConversationId})
+		case "typing":
+			s.typing(cmd)
+		case "subscribe_presence":
+			s.watchPresence(ctx, cmd.UserIds)
+		case "unsubscribe_presence":
+			for _, uid := range cmd.UserIds {
+				if sub, ok := s.presence[uid]; ok {
+					sub.stop()
+					delete(s.presence, uid)
+				}
+			}
+		case "ping":
+			_ = s.send(realtime.Event{Type: realtime.EventPong})
+		default:
+			s.sendError(cmd.ConversationId, "unknown action")
+		}
+	}
+}
+
+// subscribe 校验会话访问权限后启动该会话的投递协程（重复订阅会以新的 last_seq 重启）。
+func (s *wsSession) subscribe(c *gin.Context, ctx context.Context, cmd wsCommand) {
+	if cmd.ConversationId == "" {
+		s.sendError("", "missing conversation_id")
+		return
+	}
+	if ok, msg := canAccessConversation(c, s.userId, cmd.ConversationType, cmd.ConversationId); !ok {
+		s.sendError(cmd.ConversationId, msg)
+		return
+	}
+	for id, sub := range s.subs {
+		if sub.ctx.Err() != nil {
+			delete(s.subs, id) // 已因失去权限关闭
+		}
+	}
+	if sub, ok := s.subs[cmd.ConversationId]; ok {
+		sub.stop()
+	} else if len(s.subs) >= wsMaxSubscriptions {
+		s.sendError(cmd.ConversationId, "too many subscriptions")
+		return
+	}
+	start := currentSeq(ctx, cmd.ConversationId)
+	if cmd.LastSeq != nil && *cmd.LastSeq >= 0 {
+		start = *cmd.LastSeq
+	}
+	subCtx, stop := context.WithCancel(ctx)
+	s.subs[cmd.ConversationId] = wsSub{ctx: subCtx, stop: stop}
+	_ = s.send(realtime.Event{Type: realtime.EventSubscribed, ConversationId: cmd.ConversationId, Seq: start})
+	go func() {
+		err := newConvStream(s.userId, cmd.ConversationType, cmd.ConversationId, start, s.send).run(subCtx)
+		if errors.Is(err, errAccessRevoked) {
+			// 仅关闭该会话的订阅，连接上的其他订阅不受影响
+			stop()
+			return
+		}
+		if err != nil && subCtx.Err() == nil {
+			// 写失败或存储异常：关闭连接，由客户端携带 last_seq 重连续传
+			_ = s.conn.Close()
+		}
+	}()
+}
+
+// typing 向已订阅的会话广播输入状态（同一会话每秒至多一次“正在输入”，停止输入不限频）。
+func (s *wsSession) typing(cmd wsCommand) {
+	if sub, ok := s.subs[cmd.ConversationId]; !ok || sub.ctx.Err() != nil {
+		s.sendError(cmd.ConversationId, "not subscribed")
+		return
+	}
+	typing := cmd.Typing == nil || *cmd.Typing
+	if typing {
+		if time.Since(s.lastTyping[cmd.ConversationId]) < wsTypingInterval {
+			return
+		}
+		s.lastTyping[cmd.ConversationId] = time.Now()
+	} else {
+		delete(s.lastTyping, cmd.ConversationId)
+	}
+	realtime.Default.Publish(realtime.ConversationTopic(cmd.ConversationId), realtime.Event{
+		Type:           realtime.EventTyping,
+		ConversationId: cmd.ConversationId,
+		Data:           gin.H{"user_id": s.userId, "typing": typing},
+	})
+}
+
+// watchPresence 订阅好友/同房间参与者的在线状态：先推送当前快照，再推送变更。
+func (s *wsSession) watchPresence(ctx context.Context, userIds []string) {
+	for uid, sub := range s.presence {
+		if sub.ctx.Err() != nil {
+			delete(s.presence, uid) // 已因不再可见关闭
+		}
+	}
+	for _, uid := range userIds {
+		if _, ok := s.presence[uid]; ok {
+			continue
+		}
+		if len(s.presence) >= wsMaxSubscriptions {
+			s.sendError("", "too many presence subscriptions")
+			return
+		}
+		if !canWatchPresence(ctx, s.userId, uid) {
+			s.sendError("", "presence not visible: "+uid)
+			continue
+		}
+		subCtx, stop := context.WithCancel(ctx)
+		s.presence[uid] = wsSub{ctx: subCtx, stop: stop}
+		go func(uid string) {
+			for s.forwardPresence(subCtx, uid) {
+			}
+			stop()
+		}(uid)
+	}
+}
+
+// forwardPresence 推送快照后转发变更；订阅因消费过慢被关闭时返回 true 以重新订阅。
+// 好友关系变更时及定期复核可见性，不再可见（解除好友、拉黑、离开房间）时推送 access_revoked 并结束。
+func (s *wsSession) forwardPresence(ctx context.Context, uid string) bool {
+	sub := realtime.Default.Subscribe(realtime.PresenceTopic(uid))
+	defer sub.Close()
+	if err := s.send(realtime.Event{Type: realtime.EventPresence, Data: loadPresence(ctx, uid)}); err != nil {
+		return false
+	}
+	recheck := time.NewTicker(accessRecheck)
+	defer recheck.Stop()
+	visible := func() bool {
+		if canWatchPresence(ctx, s.userId, uid) {
+			return true
+		}
+		_ = s.send(realtime.Event{Type: realtime.EventRevoked, Data: gin.H{"user_id": uid, "message": "presence not visible"}})
+		return false
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-recheck.C:
+			if !visible() {
+				return false
+			}
+		case ev, ok := <-sub.C:
+			if !ok {
+				return true
+			}
+			if ev.Type == realtime.EventMembership {
+				if other, _ := ev.Data.(string); other == s.userId && !visible() {
+					return false
+				}
+				continue
+			}
+			if err := s.send(ev); err != nil {
+				return false
+			}
+		}
+	}
+}
+
+func (s *wsSession) pingLoop(ctx context.Context) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+			s.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
@@ -80,9 +80,19 @@ func EnsureAllIndexes(ctx context.Context) error {
 	}); err != nil {
 		return err
 	}
+	// conversation_reads 会话已读位置（每人每会话一条）
+	if err := createIndexes(ctx, db.Collection("conversation_reads"), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "userId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+	}); err != nil {
+		return err
+	}
 	if err := createIndexes(ctx, db.Collection("messages"), []mongo.IndexModel{
 		{Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "seq", Value: 1}}, Options: options.Index().SetUnique(true)},
 		{Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "mentions", Value: 1}, {Key: "seq", Value: 1}}},
+		{Keys: bson.D{{Key: "threadRootId", Value: 1}, {Key: "seq", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "searchTokens", Value: 1}}},
 	}); err != nil {
 		return err
 	}
@@ -95,13 +105,22 @@ func EnsureAllIndexes(ctx context.Context) error {
 	}
 
 	// theaters 演绎房间集合
+	if err := ensureUniqueRecruitIndex(ctx, db.Collection("theaters")); err != nil {
+		return err
+	}
 	if err := createIndexes(ctx, db.Collection("theaters"), []mongo.IndexModel{
-		{Keys: bson.D{{Key: "recruitId", Value: 1}}},
 		{Keys: bson.D{{Key: "status", Value: 1}}},
 	}); err != nil {
 		return err
 	}
 
+	// room_invites 房间邀请
+	if err := createIndexes(ctx, db.Collection("room_invites"), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "roomId", Value: 1}, {Key: "createdAt", Value: -1}}},
+	}); err != nil {
+		return err
+	}
+
 	// follow_edges 关注关系集合（防重复关注）
 	if err := createIndexes(ctx, db.Collection("follow_edges"), []mongo.IndexModel{
 		{Keys: bson.D{{Key: "followerId", Value: 1}, {Key: "followingId", Value: 1}}, Options: options.Index().SetUnique(true)}},
@@ -123,6 +142,32 @@ func EnsureAllIndexes(ctx context.Context) error {
 		return err
 	}
 
+	// costumes 用户皮
+	if err := createIndexes(ctx, db.Collection("costumes"), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "characterId", Value: 1}}},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}},
+	}); err != nil {
+		return err
+	}
+
+	// backstories 剧本
+	if err := createIndexes(ctx, db.Collection("backstories"), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "deletedAt", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "tags", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "authorUserId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "submittedAt", Value: 1}}},
+	}); err != nil {
+		return err
+	}
+
+	// notifications 站内通知
+	if err := createIndexes(ctx, db.Collection("notifications"), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "read", Value: 1}}},
+	}); err != nil {
+		return err
+	}
+
 	// recruits 招募
 	if err := createIndexes(ctx, db.Collection("recruits"), []mongo.IndexModel{
 		{Keys: bson.D{{Key: "creatorId", Value: 1}, {Key: "createdAt", Value: -1}}},
@@ -140,6 +185,21 @@ func EnsureAllIndexes(ctx context.Context) error {
 		return err
 	}
 
+	// message_reactions 消息表情回应（同一用户对同一消息的同一表情唯一）
+	if err := createIndexes(ctx, db.Collection("message_reactions"), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "messageId", Value: 1}, {Key: "userId", Value: 1}, {Key: "emoji", Value: 1}}, Options: options.Index().SetUnique(true)},
+	}); err != nil {
+		return err
+	}
+
+	// chat_media 聊天媒体（按 GridFS 文件反查所属会话做访问控制）
+	if err := createIndexes(ctx, db.Collection("chat_media"), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "fileId", Value: 1}}},
+		{Keys: bson.D{{Key: "thumbFileId", Value: 1}}, Options: options.Index().SetSparse(true)},
+	}); err != nil {
+		return err
+	}
+
 	// likes 点赞
 	if err := createIndexes(ctx, db.Collection("likes"), []mongo.IndexModel{
 		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "targetType", Value: 1}, {Key: "targetId", Value: 1}}, Options: options.Index().SetUnique(true)},
@@ -158,3 +218,36 @@ func createIndexes(ctx context.Context, col *mongo.Collection, models []mongo.In
 	_, err := col.Indexes().CreateMany(ctx, models)
 	return err
 }
+
+// ensureUniqueRecruitIndex 每个招募只对应一个房间：早期版本的 recruitId_1 为普通索引，需先删除再以唯一索引重建。
+// 存量数据中已存在重复房间时唯一索引无法建立，记录告警并保留普通索引，清理重复数据后重启即可生效。
+func ensureUniqueRecruitIndex(ctx context.Context, col *mongo.Collection) error {
+	cur, err := col.Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+	var specs []bson.M
+	if err := cur.All(ctx, &specs); err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		if spec["name"] != "recruitId_1" {
+			continue
+		}
+		if unique, _ := spec["unique"].(bool); unique {
+			return nil
+		}
+		if _, err := col.Indexes().DropOne(ctx, "recruitId_1"); err != nil {
+			return err
+		}
+	}
+	keys := bson.D{{Key: "recruitId", Value: 1}}
+	if _, err := col.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: keys, Options: options.Index().SetUnique(true)}); err != nil {
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+		zap.L().Warn("duplicate theaters found for the same recruit, recruitId index kept non-unique", zap.Error(err))
+		return createIndexes(ctx, col, []mongo.IndexModel{{Keys: keys}})
+	}
+	return nil
+}
@@ -8,28 +8,13 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"actiondelta/internal/auth"
+	"actiondelta/internal/config"
 )
 
 // AuthMiddleware 校验请求头中的JWT，并将用户ID注入到上下文。
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 优先从 Authorization: Bearer <token> 获取
-		header := c.GetHeader("Authorization")
-		token := ""
-		if header != "" && strings.HasPrefix(header, "Bearer ") {
-			token = strings.TrimPrefix(header, "Bearer ")
-		}
-		// 兼容 Authentication 头，既支持 Bearer 前缀，也支持裸 token
-		if token == "" {
-			alt := c.GetHeader("Authentication")
-			if alt != "" {
-				if strings.HasPrefix(alt, "Bearer ") {
-					token = strings.TrimPrefix(alt, "Bearer ")
-				} else {
-					token = alt
-				}
-			}
-		}
+		token := tokenFromHeader(c)
 		if token == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "missing or invalid token"})
 			return
@@ -53,3 +38,62 @@ func AuthMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// OptionalAuthMiddleware 用于“任何人”可访问的接口：携带有效令牌时注入用户ID，否则按匿名处理。
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token := tokenFromHeader(c); token != "" {
+			if claims, err := auth.ParseToken(token); err == nil {
+				c.Set("userId", claims.UserId)
+			}
+		}
+		c.Next()
+	}
+}
+
+// StreamAuthMiddleware 用于 WebSocket/SSE 等长连接：浏览器无法为其自定义请求头，
+// 因此在请求头之外也接受 access_token 查询参数。
+func StreamAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := tokenFromHeader(c)
+		if token == "" {
+			token = c.Query("access_token")
+		}
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "missing or invalid token"})
+			return
+		}
+		claims, err := auth.ParseToken(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "invalid token"})
+			return
+		}
+		c.Set("userId", claims.UserId)
+		c.Next()
+	}
+}
+
+// AdminMiddleware 仅允许配置中的管理员访问，需挂在 AuthMiddleware 之后。
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.IsAdmin(c.GetString("userId")) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"code": 403, "message": "admin only"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// tokenFromHeader 优先从 Authorization: Bearer <token> 获取；
+// 兼容 Authentication 头，既支持 Bearer 前缀，也支持裸 token。
+func tokenFromHeader(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if header != "" && strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	alt := c.GetHeader("Authentication")
+	if strings.HasPrefix(alt, "Bearer ") {
+		return strings.TrimPrefix(alt, "Bearer ")
+	}
+	return alt
+}
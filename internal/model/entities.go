@@ -20,6 +20,7 @@ type User struct {
     Gender     string             `bson:"gender" json:"gender"`
     Bio        string             `bson:"bio" json:"bio"`
     Online     bool               `bson:"online" json:"online"`
+    Instances  []string           `bson:"onlineInstances,omitempty" json:"-"` // 持有该用户实时连接的服务实例
     LastSeenAt time.Time          `bson:"lastSeenAt" json:"last_seen_at"`
     CreatedAt  time.Time          `bson:"createdAt" json:"created_at"`
     UpdatedAt  time.Time          `bson:"updatedAt" json:"updated_at"`
@@ -83,9 +84,35 @@ type Conversation struct {
     Participants     []string           `bson:"participants" json:"participants"`
     LastSeq          int64              `bson:"lastSeq" json:"last_seq"`
     LastMessage      string             `bson:"lastMessage" json:"last_message"`
+    Pinned           []PinnedMessage    `bson:"pinned,omitempty" json:"pinned,omitempty"`             // 置顶消息（群聊/房间）
+    Announcement     *Announcement      `bson:"announcement,omitempty" json:"announcement,omitempty"` // 会话公告（群聊/房间）
     UpdatedAt        time.Time          `bson:"updatedAt" json:"updated_at"`
 }
 
+// PinnedMessage 会话置顶消息
+type PinnedMessage struct {
+    MessageId primitive.ObjectID `bson:"messageId" json:"message_id"`
+    Seq       int64              `bson:"seq" json:"seq"`
+    PinnedBy  string             `bson:"pinnedBy" json:"pinned_by"`
+    PinnedAt  time.Time          `bson:"pinnedAt" json:"pinned_at"`
+}
+
+// Announcement 会话公告
+type Announcement struct {
+    Text      string    `bson:"text" json:"text"`
+    UpdatedBy string    `bson:"updatedBy" json:"updated_by"`
+    UpdatedAt time.Time `bson:"updatedAt" json:"updated_at"`
+}
+
+// ConversationRead 用户在会话中的已读位置
+type ConversationRead struct {
+    ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    ConversationId string             `bson:"conversationId" json:"conversation_id"`
+    UserId         string             `bson:"userId" json:"user_id"`
+    ReadSeq        int64              `bson:"readSeq" json:"read_seq"`
+    UpdatedAt      time.Time          `bson:"updatedAt" json:"updated_at"`
+}
+
 type Message struct {
     ID               primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
     ConversationId   string              `bson:"conversationId" json:"conversation_id"`
@@ -97,14 +124,68 @@ type Message struct {
     MessageType      string              `bson:"messageType" json:"message_type"`
     Element          MessageElement      `bson:"element" json:"element"`
     CharacterInfo    *CharacterInfo      `bson:"characterInfo,omitempty" json:"character_info,omitempty"`
+    Recalled         bool                `bson:"recalled,omitempty" json:"recalled,omitempty"`
+    RecalledAt       *time.Time          `bson:"recalledAt,omitempty" json:"recalled_at,omitempty"`
+    EditedAt         *time.Time          `bson:"editedAt,omitempty" json:"edited_at,omitempty"`
+    EditHistory      []MessageEdit       `bson:"editHistory,omitempty" json:"edit_history,omitempty"`
+    Mentions         []string            `bson:"mentions,omitempty" json:"mentions,omitempty"`         // 被 @ 的 userId
+    MentionAll       bool                `bson:"mentionAll,omitempty" json:"mention_all,omitempty"`    // @全体成员
+    ReplyToId        *primitive.ObjectID `bson:"replyToId,omitempty" json:"reply_to_id,omitempty"`       // 回复的消息（归入其线程）
+    QuoteId          *primitive.ObjectID `bson:"quoteId,omitempty" json:"quote_id,omitempty"`           // 引用的消息（不归入线程）
+    ThreadRootId     *primitive.ObjectID `bson:"threadRootId,omitempty" json:"thread_root_id,omitempty"` // 线程根消息
+    ReplyCount       int                 `bson:"replyCount,omitempty" json:"reply_count,omitempty"`     // 作为线程根时的回复数
+    RefPreview       *MessagePreview     `bson:"-" json:"ref_preview,omitempty"`                       // 回复/引用消息的摘要，读取时填充
+    Reactions        []ReactionCount     `bson:"-" json:"reactions,omitempty"`                         // 表情回应汇总，读取时填充
+    SearchTokens     []string            `bson:"searchTokens,omitempty" json:"-"`                      // 检索词（文本二字组）
     CreatedAt        time.Time           `bson:"createdAt" json:"created_at"`
     UpdatedAt        time.Time           `bson:"updatedAt" json:"updated_at"`
     DeletedAt        *time.Time          `bson:"deletedAt" json:"deleted_at"`
 }
 
+// MessagePreview 被回复/引用消息的简要信息
+type MessagePreview struct {
+    ID            primitive.ObjectID `json:"id"`
+    Seq           int64              `json:"seq"`
+    SenderUserId  string             `json:"sender_user_id"`
+    MessageType   string             `json:"message_type"`
+    CharacterInfo *CharacterInfo     `json:"character_info,omitempty"`
+    Text          string             `json:"text"`
+    Unavailable   bool               `json:"unavailable,omitempty"` // 已撤回/删除
+}
+
+// MessageReaction 消息表情回应（每人每条消息每种表情一条）
+type MessageReaction struct {
+    ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    MessageId      primitive.ObjectID `bson:"messageId" json:"message_id"`
+    ConversationId string             `bson:"conversationId" json:"conversation_id"`
+    UserId         string             `bson:"userId" json:"user_id"`
+    Emoji          string             `bson:"emoji" json:"emoji"`
+    CreatedAt      time.Time          `bson:"createdAt" json:"created_at"`
+}
+
+// ReactionCount 某种表情的回应数
+type ReactionCount struct {
+    Emoji   string `json:"emoji"`
+    Count   int    `json:"count"`
+    Reacted bool   `json:"reacted"` // 当前用户是否已回应
+}
+
+// MessageEdit 消息编辑前的版本
+type MessageEdit struct {
+    Element  MessageElement `bson:"element" json:"element"`
+    EditedAt time.Time      `bson:"editedAt" json:"edited_at"`
+}
+
 type MessageElement struct {
-    Type string                 `bson:"type" json:"type"`
-    Data map[string]interface{} `bson:"data" json:"data"`
+    Type     string                 `bson:"type" json:"type"`
+    Data     map[string]interface{} `bson:"data" json:"data"`
+    Segments []MessageSegment       `bson:"segments,omitempty" json:"segments,omitempty"` // 由 data.text 解析
+}
+
+// MessageSegment 文本片段：speech 对白 / action 【】内的动作、心理描写
+type MessageSegment struct {
+    Type string `bson:"type" json:"type"`
+    Text string `bson:"text" json:"text"`
 }
 
 type CharacterInfo struct {
@@ -117,18 +198,57 @@ type Theater struct {
     ID              primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
     RecruitId       primitive.ObjectID   `bson:"recruitId" json:"recruit_id"`
     BackstoryId     primitive.ObjectID   `bson:"backstoryId" json:"backstory_id"`
+    HostId          string               `bson:"hostId,omitempty" json:"host_id,omitempty"` // 房主（招募发布者），可置顶与设置公告
     Title           string               `bson:"title" json:"title"`
     Subtitle        string               `bson:"subtitle" json:"subtitle"`
     Mode            string               `bson:"mode" json:"mode"`
+    Capacity        int                  `bson:"capacity,omitempty" json:"capacity,omitempty"` // 人数上限（由招募模式决定）
     BackgroundStory string               `bson:"backgroundStory" json:"background_story"`
     Participants    []TheaterParticipant `bson:"participants" json:"participants"`
-    Status          string               `bson:"status" json:"status"`
+    Status          string               `bson:"status" json:"status"` // active 进行中 / ended 已结束 / archived 已归档（后两者只读）
+    EndedAt         *time.Time           `bson:"endedAt,omitempty" json:"ended_at,omitempty"`
+    KickVotes       []KickVote           `bson:"kickVotes,omitempty" json:"kick_votes,omitempty"`
+    BannedUserIds   []string             `bson:"bannedUserIds,omitempty" json:"banned_user_ids,omitempty"` // 被踢出的用户，不得再加入
     CreatedAt       time.Time            `bson:"createdAt" json:"created_at"`
     UpdatedAt       time.Time            `bson:"updatedAt" json:"updated_at"`
 }
 
+// RoomInvite 房间邀请链接（令牌为签名 JWT，记录用于过期、次数限制、撤销与审计）
+type RoomInvite struct {
+    ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    RoomId      primitive.ObjectID `bson:"roomId" json:"room_id"`
+    CreatedBy   string             `bson:"createdBy" json:"created_by"`
+    MaxUses     int                `bson:"maxUses" json:"max_uses"` // 0 表示不限次数
+    Uses        int                `bson:"uses" json:"uses"`
+    ExpiresAt   time.Time          `bson:"expiresAt" json:"expires_at"`
+    RevokedAt   *time.Time         `bson:"revokedAt,omitempty" json:"revoked_at,omitempty"`
+    Redemptions []InviteRedemption `bson:"redemptions" json:"redemptions"`
+    CreatedAt   time.Time          `bson:"createdAt" json:"created_at"`
+}
+
+// InviteRedemption 通过邀请加入的记录
+type InviteRedemption struct {
+    UserId      string    `bson:"userId" json:"user_id"`
+    CharacterId string    `bson:"characterId" json:"character_id"`
+    JoinedAt    time.Time `bson:"joinedAt" json:"joined_at"`
+}
+
+// KickVote 踢人投票（发起人默认赞成）
+type KickVote struct {
+    ID           primitive.ObjectID `bson:"id" json:"id"`
+    TargetUserId string             `bson:"targetUserId" json:"target_user_id"`
+    InitiatorId  string             `bson:"initiatorId" json:"initiator_id"`
+    Approvals    []string           `bson:"approvals" json:"approvals"`
+    Rejections   []string           `bson:"rejections" json:"rejections"`
+    Status       string             `bson:"status" json:"status"` // open 进行中 / passed 通过 / rejected 否决 / expired 过期 / cancelled 被投票人已离开
+    CreatedAt    time.Time          `bson:"createdAt" json:"created_at"`
+    ExpiresAt    time.Time          `bson:"expiresAt" json:"expires_at"`
+    ClosedAt     *time.Time         `bson:"closedAt,omitempty" json:"closed_at,omitempty"`
+}
+
 type TheaterParticipant struct {
     UserId       string    `bson:"userId" json:"user_id"`
+    CharacterId  string    `bson:"characterId" json:"character_id"`
     CostumeId    string    `bson:"costumeId" json:"costume_id"`
     CostumeName  string    `bson:"costumeName" json:"costume_name"`
     Avatar       string    `bson:"avatar" json:"avatar"`
@@ -152,6 +272,8 @@ type UserStats struct {
     FollowersCount int                `bson:"followersCount" json:"followers_count"`
     FollowingCount int                `bson:"followingCount" json:"following_count"`
     PostsCount     int                `bson:"postsCount" json:"posts_count"`
+    SpeechWords    int                `bson:"speechWords" json:"speech_words"` // 皮上对白字数
+    ActionWords    int                `bson:"actionWords" json:"action_words"` // 皮上【】动作/心理字数
     UpdatedAt      time.Time          `bson:"updatedAt" json:"updated_at"`
 }
 
@@ -226,3 +348,102 @@ type Like struct {
     CreatedAt  time.Time          `bson:"createdAt" json:"created_at"`
 }
 
+
+// Costume 用户皮：用户为某个源角色创建的扮演形象
+type Costume struct {
+    ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+    Nickname    string              `bson:"nickname" json:"nickname"`
+    Avatar      string              `bson:"avatar" json:"avatar"`
+    UserId      string              `bson:"userId" json:"user_id"`
+    UserOpenId  string              `bson:"userOpenId" json:"user_open_id"`
+    CharacterId string              `bson:"characterId" json:"character_id"`
+    BackstoryId *primitive.ObjectID `bson:"backstoryId,omitempty" json:"backstory_id,omitempty"`
+    CreatedAt   time.Time           `bson:"createdAt" json:"created_at"`
+    UpdatedAt   time.Time           `bson:"updatedAt" json:"updated_at"`
+    DeletedAt   *time.Time          `bson:"deletedAt" json:"deleted_at"`
+}
+
+// Backstory 剧本
+type Backstory struct {
+    ID               primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+    Title            string               `bson:"title" json:"title"`
+    Subtitle         string               `bson:"subtitle" json:"subtitle"`
+    Cover            []BackstoryCover     `bson:"cover" json:"cover"`
+    Content          string               `bson:"content" json:"content"`
+    AuthorName       string               `bson:"authorName" json:"author_name"`
+    AuthorUserId     string               `bson:"authorUserId" json:"author_user_id"`
+    Tags             []string             `bson:"tags" json:"tags"`
+    Characters       []BackstoryCharacter `bson:"characters" json:"characters"`
+    ViewCount        int                  `bson:"viewCount" json:"view_count"`
+    LikeCount        int                  `bson:"likeCount" json:"like_count"`
+    Status           string               `bson:"status" json:"status"` // draft 草稿 / submitted 待审核 / approved 已通过 / rejected 已驳回
+    ReviewComment    string               `bson:"reviewComment" json:"review_comment"`
+    SubmittedAt      *time.Time           `bson:"submittedAt" json:"submitted_at"`
+    ReviewedAt       *time.Time           `bson:"reviewedAt" json:"reviewed_at"`
+    ReviewedByUserId string               `bson:"reviewedByUserId" json:"reviewed_by_user_id"`
+    Revision         *BackstoryRevision   `bson:"revision,omitempty" json:"revision,omitempty"` // 已通过剧本的修订稿（仅作者可见），通过审核前公开展示的仍是原内容
+    CreatedAt        time.Time            `bson:"createdAt" json:"created_at"`
+    UpdatedAt        time.Time            `bson:"updatedAt" json:"updated_at"`
+    DeletedAt        *time.Time           `bson:"deletedAt" json:"deleted_at"`
+}
+
+// BackstoryRevision 剧本修订稿（审核通过后覆盖剧本内容）
+type BackstoryRevision struct {
+    Title         string               `bson:"title" json:"title"`
+    Subtitle      string               `bson:"subtitle" json:"subtitle"`
+    Cover         []BackstoryCover     `bson:"cover" json:"cover"`
+    Content       string               `bson:"content" json:"content"`
+    AuthorName    string               `bson:"authorName" json:"author_name"`
+    Tags          []string             `bson:"tags" json:"tags"`
+    Characters    []BackstoryCharacter `bson:"characters" json:"characters"`
+    Status        string               `bson:"status" json:"status"` // draft / submitted / rejected
+    ReviewComment string               `bson:"reviewComment" json:"review_comment"`
+    SubmittedAt   *time.Time           `bson:"submittedAt" json:"submitted_at"`
+    UpdatedAt     time.Time            `bson:"updatedAt" json:"updated_at"`
+}
+
+// BackstoryCover 剧本封面（type: rect 长图 / square 方图）
+type BackstoryCover struct {
+    Url  string `bson:"url" json:"url"`
+    Type string `bson:"type" json:"type"`
+}
+
+// BackstoryCharacter 剧本角色
+type BackstoryCharacter struct {
+    CharacterId  string `bson:"characterId" json:"character_id"`
+    Name         string `bson:"name" json:"name"`
+    Avatar       string `bson:"avatar" json:"avatar"`
+    Illustration string `bson:"illustration" json:"illustration"` // 立绘
+    Story        string `bson:"story" json:"story"`               // 角色故事
+}
+
+// Notification 站内通知
+type Notification struct {
+    ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserId     string             `bson:"userId" json:"user_id"`
+    Type       string             `bson:"type" json:"type"` // backstory_review 剧本审核结果 / mention 消息中被@
+    Title      string             `bson:"title" json:"title"`
+    Content    string             `bson:"content" json:"content"`
+    TargetType string             `bson:"targetType" json:"target_type"`
+    TargetId   string             `bson:"targetId" json:"target_id"`
+    Read       bool               `bson:"read" json:"read"`
+    CreatedAt  time.Time          `bson:"createdAt" json:"created_at"`
+}
+
+// ChatMedia 聊天媒体文件（图片/语音/表情），文件本体存于 GridFS，仅所属会话成员可访问
+type ChatMedia struct {
+    ID               primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+    Kind             string              `bson:"kind" json:"kind"` // image / voice / sticker
+    FileId           primitive.ObjectID  `bson:"fileId" json:"file_id"`
+    ThumbFileId      *primitive.ObjectID `bson:"thumbFileId,omitempty" json:"thumb_file_id,omitempty"`
+    ContentType      string              `bson:"contentType" json:"content_type"`
+    ThumbContentType string              `bson:"thumbContentType,omitempty" json:"-"`
+    Size             int64               `bson:"size" json:"size"`
+    Width            int                 `bson:"width,omitempty" json:"width,omitempty"`
+    Height           int                 `bson:"height,omitempty" json:"height,omitempty"`
+    DurationMs       int                 `bson:"durationMs,omitempty" json:"duration_ms,omitempty"`
+    ConversationId   string              `bson:"conversationId" json:"conversation_id"`
+    ConversationType string              `bson:"conversationType" json:"conversation_type"`
+    UploaderId       string              `bson:"uploaderId" json:"uploader_id"`
+    CreatedAt        time.Time           `bson:"createdAt" json:"created_at"`
+}
@@ -0,0 +1,107 @@
+package realtime
+
+import "sync"
+
+// 事件类型
+const (
+	EventMessage      = "message"         // 新消息（携带 seq，按序投递）
+	EventSubscribed   = "subscribed"      // 订阅成功（seq 为投递起点）
+	EventUnsubscribed = "unsubscribed"    // 已取消订阅
+	EventError        = "error"           // 指令错误或无权限
+	EventPong         = "pong"            // 应用层心跳响应
+	EventTyping       = "typing"          // 会话内“对方正在输入”
+	EventPresence     = "presence"        // 用户上线/离线
+	EventMsgUpdated   = "message_updated" // 消息被编辑/撤回/删除，data 为更新后的消息
+	EventReaction     = "reaction"        // 表情回应增减，seq 为消息 seq
+	EventRead         = "read"            // 私聊已读回执，seq 为对方已读到的位置
+	EventRevoked      = "access_revoked"  // 已失去会话访问权限或在线状态不再可见，订阅随即关闭
+
+	// EventMembership 服务端内部信号：会话成员变更，data 为相关用户 ID（为空表示全部订阅者）；
+	// 发往在线状态主题时表示好友关系变更，data 为需复核的订阅者。订阅方据此复核权限，不下发给客户端。
+	EventMembership = "membership_changed"
+)
+
+// Event 推送给客户端的事件。
+type Event struct {
+	Type           string `json:"type"`
+	ConversationId string `json:"conversation_id,omitempty"`
+	Seq            int64  `json:"seq,omitempty"`
+	Data           any    `json:"data,omitempty"`
+}
+
+// subscriptionBuffer 单个订阅的事件缓冲；消费过慢导致缓冲写满时订阅会被关闭，由消费方从存储补齐后重新订阅。
+const subscriptionBuffer = 256
+
+// Subscription 某个主题的订阅，事件从 C 读取；C 被关闭表示订阅已失效（溢出或 Close）。
+type Subscription struct {
+	C      chan Event
+	topic  string
+	hub    *Hub
+	closed bool
+}
+
+// Close 取消订阅（幂等）。
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Hub 进程内的发布/订阅中心，按主题（如会话）分发事件。
+type Hub struct {
+	mu     sync.Mutex
+	topics map[string]map[*Subscription]struct{}
+}
+
+// NewHub 创建空的 Hub。
+func NewHub() *Hub {
+	return &Hub{topics: make(map[string]map[*Subscription]struct{})}
+}
+
+// Default 全局 Hub（单实例部署；多实例需替换为 Redis 等外部广播）。
+var Default = NewHub()
+
+// ConversationTopic 会话主题名。
+func ConversationTopic(conversationId string) string { return "conv:" + conversationId }
+
+// Subscribe 订阅主题。
+func (h *Hub) Subscribe(topic string) *Subscription {
+	s := &Subscription{C: make(chan Event, subscriptionBuffer), topic: topic, hub: h}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs := h.topics[topic]
+	if subs == nil {
+		subs = make(map[*Subscription]struct{})
+		h.topics[topic] = subs
+	}
+	subs[s] = struct{}{}
+	return s
+}
+
+// Publish 向主题的全部订阅者投递事件，不阻塞发布方。
+func (h *Hub) Publish(topic string, ev Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.topics[topic] {
+		select {
+		case s.C <- ev:
+		default:
+			h.remove(s)
+		}
+	}
+}
+
+// remove 需持有 h.mu。
+func (h *Hub) remove(s *Subscription) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.C)
+	if subs := h.topics[s.topic]; subs != nil {
+		delete(subs, s)
+		if len(subs) == 0 {
+			delete(h.topics, s.topic)
+		}
+	}
+}
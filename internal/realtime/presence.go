@@ -0,0 +1,34 @@
+package realtime
+
+import "sync"
+
+// PresenceTopic 用户在线状态主题名。
+func PresenceTopic(userId string) string { return "presence:" + userId }
+
+// presence 按用户统计当前进程内打开的实时连接数。
+type presence struct {
+	mu    sync.Mutex
+	conns map[string]int
+}
+
+var online = &presence{conns: make(map[string]int)}
+
+// Connect 记录用户新开一条实时连接，返回是否为其第一条连接（即由离线转为在线）。
+func Connect(userId string) bool {
+	online.mu.Lock()
+	defer online.mu.Unlock()
+	online.conns[userId]++
+	return online.conns[userId] == 1
+}
+
+// Disconnect 记录用户关闭一条实时连接，返回是否为其最后一条连接（即由在线转为离线）。
+func Disconnect(userId string) bool {
+	online.mu.Lock()
+	defer online.mu.Unlock()
+	if online.conns[userId] <= 1 {
+		delete(online.conns, userId)
+		return true
+	}
+	online.conns[userId]--
+	return false
+}
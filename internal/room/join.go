@@ -0,0 +1,218 @@
+package room
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"actiondelta/internal/model"
+)
+
+// joinAttempts 并发入房时条件写入落空后按最新房间状态重试的次数
+const joinAttempts = 3
+
+// Service 房间服务
+type Service struct {
+	store Store
+}
+
+// NewService 基于给定存储创建房间服务
+func NewService(store Store) *Service {
+	return &Service{store: store}
+}
+
+// JoinRequest 入房参数：仅传 CostumeId 时以用户皮绑定的源角色作为所选角色
+type JoinRequest struct {
+	RecruitId   primitive.ObjectID
+	UserId      string
+	CharacterId string
+	CostumeId   string
+}
+
+// JoinResult 入房结果：Joined 为 false 表示用户此前已在房间中，Participant 为其原有参与者信息；
+// Room 为入房时读取的房间（新加入时已追加本次参与者）
+type JoinResult struct {
+	Room        model.Theater
+	Participant model.TheaterParticipant
+	Joined      bool
+}
+
+// Join 加入招募对应的房间。幂等：已在房间中的用户直接返回原有参与者，不再校验角色与状态。
+// 房间尚不存在时，校验通过后连同首个参与者一次写入建房，校验失败不会留下空房间；
+// 已有房间时由 Store.AddParticipant 单文档条件写入加入，并发下不会超员、不会重复占用角色；
+// 条件落空时按最新房间状态重新校验，仍可加入则重试，否则返回具体原因。
+// 失败时返回 *Error（校验不通过）或存储错误。
+func (s *Service) Join(ctx context.Context, req JoinRequest) (JoinResult, error) {
+	rec, err := s.store.Recruit(ctx, req.RecruitId)
+	if errors.Is(err, ErrNotFound) {
+		return JoinResult{}, notFound("recruit not found")
+	}
+	if err != nil {
+		return JoinResult{}, err
+	}
+	th, err := s.store.RoomByRecruit(ctx, rec.ID)
+	if errors.Is(err, ErrNotFound) {
+		res, created, err := s.create(ctx, rec, req)
+		if err != nil || created {
+			return res, err
+		}
+		// 并发下他人先建了房：按已有房间继续
+		th = res.Room
+	} else if err != nil {
+		return JoinResult{}, err
+	}
+	for i := 0; i < joinAttempts; i++ {
+		if p, ok := participant(th, req.UserId); ok {
+			return JoinResult{Room: th, Participant: p}, nil
+		}
+		part, err := s.prepare(ctx, rec, th, req)
+		if err != nil {
+			return JoinResult{Room: th}, err
+		}
+		added, err := s.store.AddParticipant(ctx, th.ID, part, Capacity(rec))
+		if err != nil {
+			return JoinResult{Room: th}, err
+		}
+		if added {
+			th.Participants = append(th.Participants, part)
+			return JoinResult{Room: th, Participant: part, Joined: true}, nil
+		}
+		if th, err = s.store.Room(ctx, th.ID); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return JoinResult{}, notFound("room not found")
+			}
+			return JoinResult{}, err
+		}
+	}
+	return JoinResult{Room: th}, conflict("room changed, please retry")
+}
+
+// create 首个入房者：按招募构造房间并校验，通过后连同参与者一起写入。
+// 返回 created=false 表示房间已被并发请求创建，res.Room 为已有房间。
+func (s *Service) create(ctx context.Context, rec model.Recruit, req JoinRequest) (JoinResult, bool, error) {
+	th, err := s.newRoom(ctx, rec)
+	if err != nil {
+		return JoinResult{}, false, err
+	}
+	part, err := s.prepare(ctx, rec, th, req)
+	if err != nil {
+		return JoinResult{}, false, err
+	}
+	th.Participants = []model.TheaterParticipant{part}
+	th, created, err := s.store.CreateRoom(ctx, th)
+	if err != nil {
+		return JoinResult{}, false, err
+	}
+	if !created {
+		return JoinResult{Room: th}, false, nil
+	}
+	return JoinResult{Room: th, Participant: part, Joined: true}, true, nil
+}
+
+// newRoom 按招募构造（未写入的）房间：标题、模式、剧本与背景故事取自招募
+// （未填标题用剧本标题，背景故事优先取招募的自定义内容），招募发布者为房主。
+func (s *Service) newRoom(ctx context.Context, rec model.Recruit) (model.Theater, error) {
+	b, err := s.store.Backstory(ctx, rec.BackstoryId)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return model.Theater{}, err
+	}
+	title := rec.Title
+	if title == "" {
+		title = b.Title
+	}
+	if title == "" {
+		title = "演绎房间"
+	}
+	story := rec.CustomContent
+	if story == "" {
+		story = b.Content
+	}
+	now := time.Now()
+	return model.Theater{
+		RecruitId:       rec.ID,
+		BackstoryId:     rec.BackstoryId,
+		HostId:          rec.CreatorId,
+		Title:           title,
+		Subtitle:        b.Subtitle,
+		Mode:            rec.Mode,
+		Capacity:        Capacity(rec),
+		BackgroundStory: story,
+		Participants:    []model.TheaterParticipant{},
+		Status:          StatusActive,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}, nil
+}
+
+// prepare 校验新加入者的房间状态、角色与用户皮并构造参与者：
+// 发布者只能选择我方角色，其他人只能选择对方角色；角色须在角色表中且未被他人占用。
+func (s *Service) prepare(ctx context.Context, rec model.Recruit, th model.Theater, req JoinRequest) (model.TheaterParticipant, error) {
+	if !Writable(th) {
+		return model.TheaterParticipant{}, conflict("room ended")
+	}
+	if containsString(th.BannedUserIds, req.UserId) {
+		return model.TheaterParticipant{}, &Error{Status: http.StatusForbidden, Msg: "kicked from room"}
+	}
+	if len(th.Participants) >= Capacity(rec) {
+		return model.TheaterParticipant{}, conflict("room full")
+	}
+	if rec.Status != "active" {
+		return model.TheaterParticipant{}, conflict("recruit not active")
+	}
+	characterId := req.CharacterId
+	var cos *model.Costume
+	if req.CostumeId != "" {
+		c, err := s.costume(ctx, req.UserId, req.CostumeId)
+		if err != nil {
+			return model.TheaterParticipant{}, err
+		}
+		cos = &c
+		if characterId == "" {
+			characterId = cos.CharacterId
+		}
+	}
+	if characterId == "" {
+		return model.TheaterParticipant{}, badRequest("character_id required")
+	}
+	allowed := rec.TargetCharacters
+	if req.UserId == rec.CreatorId {
+		allowed = rec.MyCharacters
+	}
+	if !containsString(allowed, characterId) {
+		return model.TheaterParticipant{}, badRequest("character not selectable")
+	}
+	b, err := s.store.Backstory(ctx, rec.BackstoryId)
+	if errors.Is(err, ErrNotFound) {
+		return model.TheaterParticipant{}, badRequest("backstory not found")
+	}
+	if err != nil {
+		return model.TheaterParticipant{}, err
+	}
+	ch, ok := BuildRoster(b, rec.Mode, rec.CustomCharacters)[characterId]
+	if !ok {
+		return model.TheaterParticipant{}, badRequest("unknown character")
+	}
+	if characterTaken(th, characterId) {
+		return model.TheaterParticipant{}, conflict("character already taken")
+	}
+	if err := CheckCostume(cos, rec, ch.CharacterId); err != nil {
+		return model.TheaterParticipant{}, err
+	}
+	return NewParticipant(req.UserId, ch, cos), nil
+}
+
+// costume 读取用户本人的用户皮
+func (s *Service) costume(ctx context.Context, userId, costumeId string) (model.Costume, error) {
+	oid, err := primitive.ObjectIDFromHex(costumeId)
+	if err != nil {
+		return model.Costume{}, badRequest("invalid costume id")
+	}
+	cos, err := s.store.Costume(ctx, userId, oid)
+	if errors.Is(err, ErrNotFound) {
+		return cos, badRequest("costume not found")
+	}
+	return cos, err
+}
@@ -0,0 +1,417 @@
+package room
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"actiondelta/internal/model"
+)
+
+type fixture struct {
+	store     *MemoryStore
+	svc       *Service
+	backstory model.Backstory
+}
+
+func newFixture() *fixture {
+	store := NewMemoryStore()
+	b := store.PutBackstory(model.Backstory{
+		Title:    "雨夜",
+		Subtitle: "序章",
+		Content:  "剧本正文",
+		Characters: []model.BackstoryCharacter{
+			{CharacterId: "detective", Name: "侦探", Avatar: "detective.png"},
+			{CharacterId: "butler", Name: "管家", Avatar: "butler.png"},
+			{CharacterId: "maid", Name: "女仆", Avatar: "maid.png"},
+			{CharacterId: "guest", Name: "访客", Avatar: "guest.png"},
+		},
+	})
+	return &fixture{store: store, svc: NewService(store), backstory: b}
+}
+
+func (f *fixture) recruit(mode string, mine, targets []string) model.Recruit {
+	return f.store.PutRecruit(model.Recruit{
+		BackstoryId:      f.backstory.ID,
+		CreatorId:        "host",
+		Mode:             mode,
+		MyCharacters:     mine,
+		TargetCharacters: targets,
+		Status:           "active",
+	})
+}
+
+func (f *fixture) join(t *testing.T, rec model.Recruit, userId, characterId string) JoinResult {
+	t.Helper()
+	res, err := f.svc.Join(context.Background(), JoinRequest{RecruitId: rec.ID, UserId: userId, CharacterId: characterId})
+	if err != nil {
+		t.Fatalf("join %s as %s: %v", userId, characterId, err)
+	}
+	return res
+}
+
+func expectError(t *testing.T, err error, status int, msg string) {
+	t.Helper()
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *Error %d %q, got %v", status, msg, err)
+	}
+	if e.Status != status || e.Msg != msg {
+		t.Fatalf("expected %d %q, got %d %q", status, msg, e.Status, e.Msg)
+	}
+}
+
+func TestJoinCreatesRoomFromRecruit(t *testing.T) {
+	f := newFixture()
+	rec := f.recruit(ModeCrowd, []string{"detective"}, []string{"butler", "maid"})
+
+	res := f.join(t, rec, "host", "detective")
+	if !res.Joined {
+		t.Fatal("expected first join to add participant")
+	}
+	th := res.Room
+	if th.RecruitId != rec.ID || th.HostId != "host" || th.Mode != ModeCrowd || th.Status != StatusActive {
+		t.Fatalf("unexpected room: %+v", th)
+	}
+	if th.Title != "雨夜" || th.Subtitle != "序章" || th.BackgroundStory != "剧本正文" || th.Capacity != 3 {
+		t.Fatalf("room not filled from recruit/backstory: %+v", th)
+	}
+	p := res.Participant
+	if p.UserId != "host" || p.CharacterId != "detective" || p.CostumeName != "侦探" || p.Avatar != "detective.png" {
+		t.Fatalf("unexpected participant: %+v", p)
+	}
+
+	again := f.join(t, f.recruit(ModeCouple, []string{"detective"}, []string{"butler"}), "host", "detective")
+	if again.Room.ID == th.ID {
+		t.Fatal("different recruits must get different rooms")
+	}
+}
+
+func TestJoinIsIdempotent(t *testing.T) {
+	f := newFixture()
+	rec := f.recruit(ModeCouple, []string{"detective"}, []string{"butler"})
+	first := f.join(t, rec, "alice", "butler")
+
+	// 再次入房（即使传了别的角色）返回原有参与者，不重复写入
+	second := f.join(t, rec, "alice", "maid")
+	if second.Joined {
+		t.Fatal("second join must not add participant again")
+	}
+	if second.Room.ID != first.Room.ID || second.Participant.CharacterId != "butler" {
+		t.Fatalf("expected original participant, got %+v", second.Participant)
+	}
+	th, _ := f.store.Room(context.Background(), first.Room.ID)
+	if len(th.Participants) != 1 {
+		t.Fatalf("expected 1 participant, got %d", len(th.Participants))
+	}
+
+	// 房间结束后已在房间中的用户仍可取回参与者信息
+	th.Status = StatusEnded
+	f.store.PutRoom(th)
+	if res := f.join(t, rec, "alice", ""); res.Joined || res.Participant.UserId != "alice" {
+		t.Fatalf("expected existing participant after room ended, got %+v", res)
+	}
+}
+
+func TestJoinValidation(t *testing.T) {
+	f := newFixture()
+	rec := f.recruit(ModeCrowd, []string{"detective"}, []string{"butler", "maid"})
+	ctx := context.Background()
+
+	cases := []struct {
+		name   string
+		req    JoinRequest
+		status int
+		msg    string
+	}{
+		{"unknown recruit", JoinRequest{RecruitId: primitive.NewObjectID(), UserId: "bob", CharacterId: "butler"}, http.StatusNotFound, "recruit not found"},
+		{"missing character", JoinRequest{RecruitId: rec.ID, UserId: "bob"}, http.StatusBadRequest, "character_id required"},
+		{"creator picks target side", JoinRequest{RecruitId: rec.ID, UserId: "host", CharacterId: "butler"}, http.StatusBadRequest, "character not selectable"},
+		{"other picks creator side", JoinRequest{RecruitId: rec.ID, UserId: "bob", CharacterId: "detective"}, http.StatusBadRequest, "character not selectable"},
+		{"character outside recruit", JoinRequest{RecruitId: rec.ID, UserId: "bob", CharacterId: "guest"}, http.StatusBadRequest, "character not selectable"},
+		{"invalid costume id", JoinRequest{RecruitId: rec.ID, UserId: "bob", CostumeId: "nope"}, http.StatusBadRequest, "invalid costume id"},
+		{"missing costume", JoinRequest{RecruitId: rec.ID, UserId: "bob", CostumeId: primitive.NewObjectID().Hex()}, http.StatusBadRequest, "costume not found"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := f.svc.Join(ctx, tc.req)
+			expectError(t, err, tc.status, tc.msg)
+		})
+	}
+
+	closed := f.recruit(ModeCrowd, []string{"detective"}, []string{"butler", "maid"})
+	closed.Status = "completed"
+	f.store.PutRecruit(closed)
+	_, err := f.svc.Join(ctx, JoinRequest{RecruitId: closed.ID, UserId: "bob", CharacterId: "butler"})
+	expectError(t, err, http.StatusConflict, "recruit not active")
+
+	// 被拒绝的入房不会留下空房间
+	for _, id := range []primitive.ObjectID{rec.ID, closed.ID} {
+		if _, err := f.store.RoomByRecruit(ctx, id); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("rejected joins must not create a room, got %v", err)
+		}
+	}
+}
+
+func TestJoinCharacterTakenAndCapacity(t *testing.T) {
+	f := newFixture()
+	rec := f.recruit(ModeCrowd, []string{"detective"}, []string{"butler", "maid"})
+	ctx := context.Background()
+
+	f.join(t, rec, "alice", "butler")
+	_, err := f.svc.Join(ctx, JoinRequest{RecruitId: rec.ID, UserId: "bob", CharacterId: "butler"})
+	expectError(t, err, http.StatusConflict, "character already taken")
+
+	f.join(t, rec, "bob", "maid")
+	f.join(t, rec, "host", "detective")
+	_, err = f.svc.Join(ctx, JoinRequest{RecruitId: rec.ID, UserId: "carol", CharacterId: "maid"})
+	expectError(t, err, http.StatusConflict, "room full")
+}
+
+func TestJoinLegacyParticipantHoldsCharacter(t *testing.T) {
+	f := newFixture()
+	rec := f.recruit(ModeCouple, []string{"detective"}, []string{"butler"})
+	// 早期数据：角色 ID 存在 costumeId 中
+	f.store.PutRoom(model.Theater{
+		RecruitId:    rec.ID,
+		Status:       "",
+		Participants: []model.TheaterParticipant{{UserId: "old", CostumeId: "butler"}},
+	})
+	_, err := f.svc.Join(context.Background(), JoinRequest{RecruitId: rec.ID, UserId: "bob", CharacterId: "butler"})
+	expectError(t, err, http.StatusConflict, "character already taken")
+}
+
+func TestJoinLegacyRoomWithoutStatus(t *testing.T) {
+	f := newFixture()
+	rec := f.recruit(ModeCouple, []string{"detective"}, []string{"butler"})
+	// 早期房间文档没有 status 字段（按 Mongo 中的形态解码）
+	raw, err := bson.Marshal(bson.M{"recruitId": rec.ID, "participants": bson.A{bson.M{"userId": "host", "characterId": "detective"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var legacy model.Theater
+	if err := bson.Unmarshal(raw, &legacy); err != nil {
+		t.Fatal(err)
+	}
+	th := f.store.PutRoom(legacy)
+	if !Writable(th) {
+		t.Fatal("room without status should be writable")
+	}
+	if res := f.join(t, rec, "bob", "butler"); !res.Joined {
+		t.Fatal("expected bob to join legacy room")
+	}
+
+	// Mongo 写入条件须同样接受缺失的 status：{$in: [..., nil]} 才会匹配字段不存在的文档
+	in, _ := addParticipantFilter(th.ID, model.TheaterParticipant{UserId: "carol", CharacterId: "maid"}, 2)["status"].(bson.M)["$in"].([]interface{})
+	hasNil := false
+	for _, v := range in {
+		if v == nil {
+			hasNil = true
+		}
+	}
+	if !hasNil {
+		t.Fatalf("status filter %v does not match a missing status field", in)
+	}
+}
+
+func TestJoinRoomStateRules(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+
+	ended := f.recruit(ModeCouple, []string{"detective"}, []string{"butler"})
+	f.store.PutRoom(model.Theater{RecruitId: ended.ID, Status: StatusArchived})
+	_, err := f.svc.Join(ctx, JoinRequest{RecruitId: ended.ID, UserId: "bob", CharacterId: "butler"})
+	expectError(t, err, http.StatusConflict, "room ended")
+
+	banned := f.recruit(ModeCouple, []string{"detective"}, []string{"butler"})
+	f.store.PutRoom(model.Theater{RecruitId: banned.ID, Status: StatusActive, BannedUserIds: []string{"bob"}})
+	_, err = f.svc.Join(ctx, JoinRequest{RecruitId: banned.ID, UserId: "bob", CharacterId: "butler"})
+	expectError(t, err, http.StatusForbidden, "kicked from room")
+}
+
+func TestJoinWithCostume(t *testing.T) {
+	f := newFixture()
+	rec := f.recruit(ModeCouple, []string{"detective"}, []string{"butler"})
+	ctx := context.Background()
+	other := primitive.NewObjectID()
+
+	wrongBackstory := f.store.PutCostume(model.Costume{UserId: "bob", CharacterId: "butler", BackstoryId: &other, Nickname: "别家管家"})
+	_, err := f.svc.Join(ctx, JoinRequest{RecruitId: rec.ID, UserId: "bob", CostumeId: wrongBackstory.ID.Hex()})
+	expectError(t, err, http.StatusBadRequest, "costume belongs to another backstory")
+
+	mismatch := f.store.PutCostume(model.Costume{UserId: "bob", CharacterId: "maid", Nickname: "女仆皮"})
+	_, err = f.svc.Join(ctx, JoinRequest{RecruitId: rec.ID, UserId: "bob", CharacterId: "butler", CostumeId: mismatch.ID.Hex()})
+	expectError(t, err, http.StatusBadRequest, "costume does not match character")
+
+	foreign := f.store.PutCostume(model.Costume{UserId: "carol", CharacterId: "butler"})
+	_, err = f.svc.Join(ctx, JoinRequest{RecruitId: rec.ID, UserId: "bob", CostumeId: foreign.ID.Hex()})
+	expectError(t, err, http.StatusBadRequest, "costume not found")
+
+	// 仅传用户皮时以其源角色入房，展示皮的昵称；皮未设头像时沿用角色头像
+	cos := f.store.PutCostume(model.Costume{UserId: "bob", CharacterId: "butler", BackstoryId: &f.backstory.ID, Nickname: "老管家"})
+	res, err := f.svc.Join(ctx, JoinRequest{RecruitId: rec.ID, UserId: "bob", CostumeId: cos.ID.Hex()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := res.Participant
+	if p.CharacterId != "butler" || p.CostumeId != cos.ID.Hex() || p.CostumeName != "老管家" || p.Avatar != "butler.png" {
+		t.Fatalf("unexpected participant: %+v", p)
+	}
+}
+
+func TestJoinDramaCustomCharacter(t *testing.T) {
+	f := newFixture()
+	rec := f.recruit(ModeDrama, []string{"detective"}, []string{"butler", "ghost"})
+	rec.CustomCharacters = []model.CustomCharacter{{CharacterId: "ghost", Name: "幽灵", Avatar: "ghost.png"}}
+	f.store.PutRecruit(rec)
+
+	res := f.join(t, rec, "bob", "ghost")
+	if res.Participant.CostumeName != "幽灵" || res.Participant.Avatar != "ghost.png" {
+		t.Fatalf("unexpected participant: %+v", res.Participant)
+	}
+}
+
+func TestJoinConcurrent(t *testing.T) {
+	f := newFixture()
+	rec := f.recruit(ModeCrowd, []string{"detective"}, []string{"butler", "maid", "guest"})
+	ctx := context.Background()
+
+	// 多人争抢同一角色：只有一人成功，且只创建一个房间
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	winners := 0
+	rooms := make(map[primitive.ObjectID]bool)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(userId string) {
+			defer wg.Done()
+			res, err := f.svc.Join(ctx, JoinRequest{RecruitId: rec.ID, UserId: userId, CharacterId: "butler"})
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				winners++
+				rooms[res.Room.ID] = true
+				return
+			}
+			var e *Error
+			if !errors.As(err, &e) || e.Status != http.StatusConflict {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}("user-" + strconv.Itoa(i))
+	}
+	wg.Wait()
+	if winners != 1 || len(rooms) != 1 {
+		t.Fatalf("expected exactly one winner in one room, got %d winners in %d rooms", winners, len(rooms))
+	}
+
+	// 同一用户并发重复入房只写入一次
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := f.svc.Join(ctx, JoinRequest{RecruitId: rec.ID, UserId: "dave", CharacterId: "maid"}); err != nil {
+				t.Errorf("repeat join: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	th, err := f.store.RoomByRecruit(ctx, rec.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(th.Participants) != 2 {
+		t.Fatalf("expected 2 participants, got %+v", th.Participants)
+	}
+}
+
+// racingStore 在第一次写入前执行 before，模拟读取房间后被并发请求抢先修改
+type racingStore struct {
+	*MemoryStore
+	once   sync.Once
+	before func()
+}
+
+func (s *racingStore) AddParticipant(ctx context.Context, roomId primitive.ObjectID, p model.TheaterParticipant, capacity int) (bool, error) {
+	s.once.Do(s.before)
+	return s.MemoryStore.AddParticipant(ctx, roomId, p, capacity)
+}
+
+func TestJoinAfterLostRace(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+	race := func(rec model.Recruit, before func(th model.Theater)) (JoinResult, error) {
+		th := f.join(t, rec, "host", "detective").Room
+		store := &racingStore{MemoryStore: f.store, before: func() { before(th) }}
+		return NewService(store).Join(ctx, JoinRequest{RecruitId: rec.ID, UserId: "bob", CharacterId: "butler"})
+	}
+
+	// 抢先者选了其他角色：条件写入仍然成立
+	rec := f.recruit(ModeCrowd, []string{"detective"}, []string{"butler", "maid"})
+	res, err := race(rec, func(th model.Theater) {
+		_, _ = f.store.AddParticipant(ctx, th.ID, model.TheaterParticipant{UserId: "rival", CharacterId: "maid"}, 3)
+	})
+	if err != nil || !res.Joined {
+		t.Fatalf("expected join to succeed, got %+v, %v", res, err)
+	}
+	th, _ := f.store.RoomByRecruit(ctx, rec.ID)
+	if len(th.Participants) != 3 {
+		t.Fatalf("expected host, rival and bob in room, got %+v", th.Participants)
+	}
+
+	// 抢先者占用了同一角色：按最新状态返回具体原因
+	rec = f.recruit(ModeCrowd, []string{"detective"}, []string{"butler", "maid"})
+	_, err = race(rec, func(th model.Theater) {
+		_, _ = f.store.AddParticipant(ctx, th.ID, model.TheaterParticipant{UserId: "rival", CharacterId: "butler"}, 3)
+	})
+	expectError(t, err, http.StatusConflict, "character already taken")
+
+	// 房主恰好结束了演绎
+	rec = f.recruit(ModeCrowd, []string{"detective"}, []string{"butler", "maid"})
+	_, err = race(rec, func(th model.Theater) {
+		th.Status = StatusEnded
+		f.store.PutRoom(th)
+	})
+	expectError(t, err, http.StatusConflict, "room ended")
+}
+
+// creatingStore 在建房前由并发请求先建好房间（rival 已入房）
+type creatingStore struct {
+	*MemoryStore
+	rival model.TheaterParticipant
+}
+
+func (s *creatingStore) CreateRoom(ctx context.Context, th model.Theater) (model.Theater, bool, error) {
+	first := th
+	first.Participants = []model.TheaterParticipant{s.rival}
+	_, _, _ = s.MemoryStore.CreateRoom(ctx, first)
+	return s.MemoryStore.CreateRoom(ctx, th)
+}
+
+func TestJoinAfterLostCreate(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+
+	// 对方建房时选了其他角色：加入已有房间
+	rec := f.recruit(ModeCrowd, []string{"detective"}, []string{"butler", "maid"})
+	svc := NewService(&creatingStore{MemoryStore: f.store, rival: model.TheaterParticipant{UserId: "rival", CharacterId: "maid"}})
+	res, err := svc.Join(ctx, JoinRequest{RecruitId: rec.ID, UserId: "bob", CharacterId: "butler"})
+	if err != nil || !res.Joined {
+		t.Fatalf("expected join into existing room, got %+v, %v", res, err)
+	}
+	th, _ := f.store.RoomByRecruit(ctx, rec.ID)
+	if len(th.Participants) != 2 || th.ID != res.Room.ID {
+		t.Fatalf("expected rival and bob in one room, got %+v", th.Participants)
+	}
+
+	// 对方建房时占用了同一角色
+	rec = f.recruit(ModeCrowd, []string{"detective"}, []string{"butler", "maid"})
+	svc = NewService(&creatingStore{MemoryStore: f.store, rival: model.TheaterParticipant{UserId: "rival", CharacterId: "butler"}})
+	_, err = svc.Join(ctx, JoinRequest{RecruitId: rec.ID, UserId: "bob", CharacterId: "butler"})
+	expectError(t, err, http.StatusConflict, "character already taken")
+}
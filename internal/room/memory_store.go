@@ -0,0 +1,166 @@
+package room
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"actiondelta/internal/model"
+)
+
+// MemoryStore 进程内 Store 实现（用于测试），写入条件与 MongoStore 一致
+type MemoryStore struct {
+	mu          sync.Mutex
+	recruits    map[primitive.ObjectID]model.Recruit
+	backstories map[primitive.ObjectID]model.Backstory
+	costumes    map[primitive.ObjectID]model.Costume
+	rooms       map[primitive.ObjectID]model.Theater
+}
+
+// NewMemoryStore 创建空的内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		recruits:    make(map[primitive.ObjectID]model.Recruit),
+		backstories: make(map[primitive.ObjectID]model.Backstory),
+		costumes:    make(map[primitive.ObjectID]model.Costume),
+		rooms:       make(map[primitive.ObjectID]model.Theater),
+	}
+}
+
+// PutRecruit 写入招募（ID 为空时自动生成），返回写入的招募
+func (s *MemoryStore) PutRecruit(rec model.Recruit) model.Recruit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec.ID.IsZero() {
+		rec.ID = primitive.NewObjectID()
+	}
+	s.recruits[rec.ID] = rec
+	return rec
+}
+
+// PutBackstory 写入剧本（ID 为空时自动生成），返回写入的剧本
+func (s *MemoryStore) PutBackstory(b model.Backstory) model.Backstory {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b.ID.IsZero() {
+		b.ID = primitive.NewObjectID()
+	}
+	s.backstories[b.ID] = b
+	return b
+}
+
+// PutCostume 写入用户皮（ID 为空时自动生成），返回写入的用户皮
+func (s *MemoryStore) PutCostume(cos model.Costume) model.Costume {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cos.ID.IsZero() {
+		cos.ID = primitive.NewObjectID()
+	}
+	s.costumes[cos.ID] = cos
+	return cos
+}
+
+// PutRoom 直接覆盖房间（ID 为空时自动生成），用于构造已结束、已封禁等状态
+func (s *MemoryStore) PutRoom(th model.Theater) model.Theater {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if th.ID.IsZero() {
+		th.ID = primitive.NewObjectID()
+	}
+	s.rooms[th.ID] = cloneRoom(th)
+	return th
+}
+
+func (s *MemoryStore) Recruit(_ context.Context, id primitive.ObjectID) (model.Recruit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.recruits[id]
+	if !ok || rec.DeletedAt != nil {
+		return model.Recruit{}, ErrNotFound
+	}
+	return rec, nil
+}
+
+func (s *MemoryStore) Backstory(_ context.Context, id primitive.ObjectID) (model.Backstory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.backstories[id]
+	if !ok || b.DeletedAt != nil {
+		return model.Backstory{}, ErrNotFound
+	}
+	return b, nil
+}
+
+func (s *MemoryStore) Costume(_ context.Context, userId string, id primitive.ObjectID) (model.Costume, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cos, ok := s.costumes[id]
+	if !ok || cos.UserId != userId || cos.DeletedAt != nil {
+		return model.Costume{}, ErrNotFound
+	}
+	return cos, nil
+}
+
+func (s *MemoryStore) Room(_ context.Context, id primitive.ObjectID) (model.Theater, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	th, ok := s.rooms[id]
+	if !ok {
+		return model.Theater{}, ErrNotFound
+	}
+	return cloneRoom(th), nil
+}
+
+func (s *MemoryStore) RoomByRecruit(_ context.Context, recruitId primitive.ObjectID) (model.Theater, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if th, ok := s.roomByRecruit(recruitId); ok {
+		return cloneRoom(th), nil
+	}
+	return model.Theater{}, ErrNotFound
+}
+
+func (s *MemoryStore) CreateRoom(_ context.Context, th model.Theater) (model.Theater, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.roomByRecruit(th.RecruitId); ok {
+		return cloneRoom(existing), false, nil
+	}
+	th.ID = primitive.NewObjectID()
+	s.rooms[th.ID] = cloneRoom(th)
+	return th, true, nil
+}
+
+func (s *MemoryStore) AddParticipant(_ context.Context, roomId primitive.ObjectID, p model.TheaterParticipant, capacity int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	th, ok := s.rooms[roomId]
+	if !ok || !Writable(th) || containsString(th.BannedUserIds, p.UserId) || len(th.Participants) >= capacity {
+		return false, nil
+	}
+	if _, in := participant(th, p.UserId); in || characterTaken(th, p.CharacterId) {
+		return false, nil
+	}
+	th.Participants = append(th.Participants, p)
+	th.UpdatedAt = time.Now()
+	s.rooms[roomId] = th
+	return true, nil
+}
+
+func (s *MemoryStore) roomByRecruit(recruitId primitive.ObjectID) (model.Theater, bool) {
+	for _, th := range s.rooms {
+		if th.RecruitId == recruitId {
+			return th, true
+		}
+	}
+	return model.Theater{}, false
+}
+
+// cloneRoom 复制参与者切片，避免调用方修改影响存储内容
+func cloneRoom(th model.Theater) model.Theater {
+	th.Participants = append([]model.TheaterParticipant{}, th.Participants...)
+	th.BannedUserIds = append([]string(nil), th.BannedUserIds...)
+	return th
+}
@@ -0,0 +1,109 @@
+package room
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"actiondelta/internal/model"
+	"actiondelta/internal/repository"
+)
+
+// MongoStore 基于全局 Mongo 连接的 Store 实现（每次调用时取 repository.DB()，可在连接初始化前创建）
+type MongoStore struct{}
+
+// NewMongoStore 创建 Mongo 存储
+func NewMongoStore() *MongoStore { return &MongoStore{} }
+
+func (MongoStore) findOne(ctx context.Context, col string, filter bson.M, out interface{}) error {
+	err := repository.DB().Collection(col).FindOne(ctx, filter).Decode(out)
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s MongoStore) Recruit(ctx context.Context, id primitive.ObjectID) (model.Recruit, error) {
+	var rec model.Recruit
+	err := s.findOne(ctx, "recruits", bson.M{"_id": id, "deletedAt": nil}, &rec)
+	return rec, err
+}
+
+func (s MongoStore) Backstory(ctx context.Context, id primitive.ObjectID) (model.Backstory, error) {
+	var b model.Backstory
+	err := s.findOne(ctx, "backstories", bson.M{"_id": id, "deletedAt": nil}, &b)
+	return b, err
+}
+
+func (s MongoStore) Costume(ctx context.Context, userId string, id primitive.ObjectID) (model.Costume, error) {
+	var cos model.Costume
+	err := s.findOne(ctx, "costumes", bson.M{"_id": id, "userId": userId, "deletedAt": nil}, &cos)
+	return cos, err
+}
+
+func (s MongoStore) Room(ctx context.Context, id primitive.ObjectID) (model.Theater, error) {
+	var th model.Theater
+	err := s.findOne(ctx, "theaters", bson.M{"_id": id}, &th)
+	return th, err
+}
+
+func (s MongoStore) RoomByRecruit(ctx context.Context, recruitId primitive.ObjectID) (model.Theater, error) {
+	var th model.Theater
+	if err := s.findOne(ctx, "theaters", bson.M{"recruitId": recruitId}, &th); err != nil {
+		return th, err
+	}
+	if th.Participants == nil {
+		// 早期版本建房后入房失败会留下 participants=null，无法 $push
+		_, _ = repository.DB().Collection("theaters").UpdateOne(ctx, bson.M{"_id": th.ID, "participants": nil},
+			bson.M{"$set": bson.M{"participants": []model.TheaterParticipant{}}})
+	}
+	return th, nil
+}
+
+// CreateRoom 以 recruitId 为条件 upsert（配合 recruitId 唯一索引，并发下只创建一个房间）；
+// 预先分配 _id，返回文档的 _id 与之相同即为本次插入
+func (s MongoStore) CreateRoom(ctx context.Context, th model.Theater) (model.Theater, bool, error) {
+	col := repository.DB().Collection("theaters")
+	th.ID = primitive.NewObjectID()
+	var out model.Theater
+	err := col.FindOneAndUpdate(ctx, bson.M{"recruitId": th.RecruitId}, bson.M{"$setOnInsert": th},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&out)
+	if mongo.IsDuplicateKeyError(err) {
+		out, err = s.RoomByRecruit(ctx, th.RecruitId)
+		return out, false, err
+	}
+	if err != nil {
+		return out, false, err
+	}
+	return out, out.ID == th.ID, nil
+}
+
+// AddParticipant 单文档条件 $push：独立部署的 Mongo 不支持事务，由筛选条件保证并发安全
+func (MongoStore) AddParticipant(ctx context.Context, roomId primitive.ObjectID, p model.TheaterParticipant, capacity int) (bool, error) {
+	res, err := repository.DB().Collection("theaters").UpdateOne(ctx, addParticipantFilter(roomId, p, capacity),
+		bson.M{"$push": bson.M{"participants": p}, "$set": bson.M{"updatedAt": time.Now()}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// addParticipantFilter AddParticipant 的写入条件，与 Writable 一致：早期房间没有 status 字段（nil 同时匹配字段缺失）
+func addParticipantFilter(roomId primitive.ObjectID, p model.TheaterParticipant, capacity int) bson.M {
+	return bson.M{
+		"_id":                 roomId,
+		"status":              bson.M{"$in": []interface{}{StatusActive, "", nil}},
+		"bannedUserIds":       bson.M{"$ne": p.UserId},
+		"participants.userId": bson.M{"$ne": p.UserId},
+		"participants": bson.M{"$not": bson.M{"$elemMatch": bson.M{"$or": []bson.M{
+			{"characterId": p.CharacterId},
+			{"characterId": bson.M{"$in": []interface{}{nil, ""}}, "costumeId": p.CharacterId},
+		}}}},
+		"participants." + strconv.Itoa(capacity-1): bson.M{"$exists": false},
+	}
+}
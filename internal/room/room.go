@@ -0,0 +1,138 @@
+// Package room 演绎房间的入房流程：按招募创建房间、校验角色与用户皮、原子加入参与者。
+// 入房、接取招募与邀请链接共用同一个 Service，存储通过 Store 接口抽象（Mongo / 内存）。
+package room
+
+import (
+	"net/http"
+	"time"
+
+	"actiondelta/internal/model"
+)
+
+// 演绎模式
+const (
+	ModeCouple = "couple" // 双人
+	ModeCrowd  = "crowd"  // 多人
+	ModeDrama  = "drama"  // 剧情（可自定义角色）
+)
+
+// 房间状态
+const (
+	StatusActive   = "active"
+	StatusEnded    = "ended"    // 房主结束演绎
+	StatusArchived = "archived" // 长时间无新消息自动归档
+)
+
+// Error 入房校验失败：Status 为对应的 HTTP 状态码，Msg 为返回给客户端的提示
+type Error struct {
+	Status int
+	Msg    string
+}
+
+func (e *Error) Error() string { return e.Msg }
+
+func badRequest(msg string) *Error { return &Error{Status: http.StatusBadRequest, Msg: msg} }
+func conflict(msg string) *Error   { return &Error{Status: http.StatusConflict, Msg: msg} }
+func notFound(msg string) *Error   { return &Error{Status: http.StatusNotFound, Msg: msg} }
+
+// Character 招募可选角色（来自剧本角色或剧情模式的自定义角色）
+type Character struct {
+	CharacterId string `json:"character_id"`
+	Name        string `json:"name"`
+	Avatar      string `json:"avatar"`
+}
+
+// BuildRoster 合并剧本角色与（剧情模式下的）自定义角色
+func BuildRoster(b model.Backstory, mode string, custom []model.CustomCharacter) map[string]Character {
+	roster := make(map[string]Character, len(b.Characters)+len(custom))
+	for _, ch := range b.Characters {
+		roster[ch.CharacterId] = Character{CharacterId: ch.CharacterId, Name: ch.Name, Avatar: ch.Avatar}
+	}
+	if mode == ModeDrama {
+		for _, ch := range custom {
+			roster[ch.CharacterId] = Character{CharacterId: ch.CharacterId, Name: ch.Name, Avatar: ch.Avatar}
+		}
+	}
+	return roster
+}
+
+// Capacity 房间人数上限：双人模式 2 人，多人/剧情模式为发布者加对方角色数
+func Capacity(rec model.Recruit) int {
+	if rec.Mode == ModeCouple {
+		return 2
+	}
+	return 1 + len(rec.TargetCharacters)
+}
+
+// Writable 进行中的房间可发言、可加入；早期数据未写 status 按进行中处理
+func Writable(th model.Theater) bool {
+	return th.Status == "" || th.Status == StatusActive
+}
+
+// CharacterOf 参与者的角色 ID；兼容旧数据：早期版本将角色 ID 直接存于 costumeId
+func CharacterOf(p model.TheaterParticipant) string {
+	if p.CharacterId != "" {
+		return p.CharacterId
+	}
+	return p.CostumeId
+}
+
+// NewParticipant 构造房间参与者：选用用户皮时以皮的昵称/头像展示，否则使用源角色信息
+func NewParticipant(userId string, ch Character, cos *model.Costume) model.TheaterParticipant {
+	p := model.TheaterParticipant{
+		UserId:      userId,
+		CharacterId: ch.CharacterId,
+		CostumeName: ch.Name,
+		Avatar:      ch.Avatar,
+		JoinTime:    time.Now(),
+	}
+	if cos != nil {
+		p.CostumeId = cos.ID.Hex()
+		p.CostumeName = cos.Nickname
+		if cos.Avatar != "" {
+			p.Avatar = cos.Avatar
+		}
+	}
+	return p
+}
+
+// CheckCostume 校验用户皮与所选角色匹配（皮绑定了剧本时还需与招募剧本一致）
+func CheckCostume(cos *model.Costume, rec model.Recruit, characterId string) *Error {
+	if cos == nil {
+		return nil
+	}
+	if cos.CharacterId != characterId {
+		return badRequest("costume does not match character")
+	}
+	if cos.BackstoryId != nil && *cos.BackstoryId != rec.BackstoryId {
+		return badRequest("costume belongs to another backstory")
+	}
+	return nil
+}
+
+func participant(th model.Theater, userId string) (model.TheaterParticipant, bool) {
+	for _, p := range th.Participants {
+		if p.UserId == userId {
+			return p, true
+		}
+	}
+	return model.TheaterParticipant{}, false
+}
+
+func characterTaken(th model.Theater, characterId string) bool {
+	for _, p := range th.Participants {
+		if CharacterOf(p) == characterId {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
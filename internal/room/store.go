@@ -0,0 +1,33 @@
+package room
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"actiondelta/internal/model"
+)
+
+// ErrNotFound 记录不存在（或已删除）
+var ErrNotFound = errors.New("not found")
+
+// Store 入房流程依赖的存储。读取不到记录时返回 ErrNotFound。
+type Store interface {
+	// Recruit 读取未删除的招募
+	Recruit(ctx context.Context, id primitive.ObjectID) (model.Recruit, error)
+	// Backstory 读取未删除的剧本
+	Backstory(ctx context.Context, id primitive.ObjectID) (model.Backstory, error)
+	// Costume 读取属于 userId 且未删除的用户皮
+	Costume(ctx context.Context, userId string, id primitive.ObjectID) (model.Costume, error)
+	// Room 按 ID 读取房间
+	Room(ctx context.Context, id primitive.ObjectID) (model.Theater, error)
+	// RoomByRecruit 读取招募对应的房间
+	RoomByRecruit(ctx context.Context, recruitId primitive.ObjectID) (model.Theater, error)
+	// CreateRoom 为 th.RecruitId 创建房间（连同其中的参与者一次写入），返回 true；
+	// 该招募已有房间时不写入，返回已有房间与 false（每个招募只有一个房间）
+	CreateRoom(ctx context.Context, th model.Theater) (model.Theater, bool, error)
+	// AddParticipant 原子地加入参与者，仅当房间进行中、人数少于 capacity、用户未在房间且未被移出、
+	// 角色未被占用时写入；条件不满足返回 false
+	AddParticipant(ctx context.Context, roomId primitive.ObjectID, p model.TheaterParticipant, capacity int) (bool, error)
+}
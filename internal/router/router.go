@@ -23,7 +23,14 @@ func New() *gin.Engine {
 	r.POST("/api/user/oneclick_login", controller.OneClickLogin)
 	r.POST("/api/auth/refresh", controller.RefreshToken)
 	// 文件下载（公开访问）
-	r.GET("/api/file/:id", controller.GetFile)
+	r.GET("/api/file/:id", middleware.OptionalAuthMiddleware(), controller.GetFile)
+	// 剧本浏览（任何人）
+	r.GET("/api/backstory/list", controller.ListBackstories)
+	r.GET("/api/backstory/detail/:id", middleware.OptionalAuthMiddleware(), controller.GetBackstory)
+
+	// Realtime 实时通道（令牌可放在 access_token 查询参数）
+	r.GET("/api/ws", middleware.StreamAuthMiddleware(), controller.RealtimeWS)
+	r.GET("/api/message/stream", middleware.StreamAuthMiddleware(), controller.StreamMessages)
 
 	// Protected group 需鉴权接口
 	auth := r.Group("/api", middleware.AuthMiddleware())
@@ -67,11 +74,58 @@ func New() *gin.Engine {
 	// Messaging 消息模块
 	auth.POST("/message/send", controller.SendMessage)
 	auth.GET("/message/history", controller.GetMessageHistory)
+	auth.GET("/message/search", controller.SearchMessages)
+	auth.POST("/message/:id/recall", controller.RecallMessage)
+	auth.PUT("/message/:id", controller.EditMessage)
+	auth.DELETE("/message/:id", controller.DeleteMessage)
+	auth.POST("/message/media", controller.UploadChatMedia)
+	auth.GET("/file/:id/url", controller.SignFileURL)
+	auth.GET("/message/:id/thread", controller.GetMessageThread)
+	auth.POST("/message/:id/reaction", controller.AddReaction)
+	auth.DELETE("/message/:id/reaction", controller.RemoveReaction)
+	auth.POST("/message/:id/pin", controller.PinMessage)
+	auth.DELETE("/message/:id/pin", controller.UnpinMessage)
+
+	// Conversation 会话列表与已读
+	auth.GET("/conversation/list", controller.ListConversations)
+	auth.POST("/conversation/dm", controller.OpenDirectConversation)
+	auth.POST("/conversation/read", controller.MarkConversationRead)
+	auth.GET("/conversation/detail", controller.GetConversationDetail)
+	auth.PUT("/conversation/announcement", controller.SetAnnouncement)
 
 	// Room 演绎房间
 	auth.POST("/room/join", controller.JoinRoom)
+	auth.POST("/room/invite/redeem", controller.RedeemRoomInvite)
+	auth.GET("/room/:id", controller.GetRoom)
 	auth.GET("/room/:id/messages", controller.GetRoomMessages)
 	auth.POST("/room/:id/message", controller.SendRoomMessage)
+	auth.PUT("/room/:id/costume", controller.SetRoomCostume)
+	auth.POST("/room/:id/leave", controller.LeaveRoom)
+	auth.POST("/room/:id/end", controller.EndRoom)
+	auth.POST("/room/:id/reopen", controller.ReopenRoom)
+	auth.POST("/room/:id/kick", controller.StartKick)
+	auth.POST("/room/:id/kick/:vote_id", controller.CastKickVote)
+	auth.POST("/room/:id/invite", controller.CreateRoomInvite)
+	auth.GET("/room/:id/invites", controller.ListRoomInvites)
+	auth.DELETE("/room/:id/invite/:invite_id", controller.RevokeRoomInvite)
+
+	// Costume 用户皮
+	auth.POST("/costume", controller.CreateCostume)
+	auth.GET("/costume/my", controller.ListMyCostumes)
+	auth.PUT("/costume/:id", controller.UpdateCostume)
+	auth.POST("/costume/:id/avatar", controller.UploadCostumeAvatar)
+	auth.DELETE("/costume/:id", controller.DeleteCostume)
+
+	// Backstory 剧本模块（作者管理）
+	auth.GET("/backstory/my", controller.ListMyBackstories)
+	auth.POST("/backstory/create", controller.CreateBackstory)
+	auth.PUT("/backstory/:id", controller.UpdateBackstory)
+	auth.DELETE("/backstory/:id", controller.DeleteBackstory)
+	auth.POST("/backstory/:id/submit", controller.SubmitBackstory)
+
+	// Notification 站内通知
+	auth.GET("/notification/list", controller.ListNotifications)
+	auth.POST("/notification/read", controller.MarkNotificationsRead)
 
 	// Recruit 招募模块
 	auth.GET("/recruit/list", controller.ListRecruits)
@@ -93,5 +147,10 @@ func New() *gin.Engine {
 	// Admin 后台管理模块（受保护）
 	auth.GET("/admin/userList", controller.GetAdminStats)
 
+	// 剧本审核（仅管理员）
+	admin := auth.Group("/admin", middleware.AdminMiddleware())
+	admin.GET("/backstory/reviews", controller.ListBackstoryReviews)
+	admin.POST("/backstory/:id/review", controller.ReviewBackstory)
+
 	return r
 }